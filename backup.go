@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// backupFile copies the existing file at localFile into backupDir under the
+// same vendor/ relative path, before modvendor overwrites it. It returns
+// false if there was no existing file to back up.
+func backupFile(backupDir, localPath, localFile string) (bool, error) {
+	if _, err := os.Stat(longPath(localFile)); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	backupPath := filepath.Join(backupDir, filepath.FromSlash(localPath))
+	if err := os.MkdirAll(longPath(filepath.Dir(backupPath)), 0755); err != nil {
+		return false, err
+	}
+	if _, err := copyFile(localFile, backupPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Rollback tracks the changes made to ./vendor/ during a run, so they can be
+// undone if copying fails midway.
+type Rollback struct {
+	BackupDir string
+	Restore   map[string]string // local file -> backup file
+	Created   []string          // files and directories created by this run
+}
+
+func newRollback(backupDir string) *Rollback {
+	return &Rollback{
+		BackupDir: backupDir,
+		Restore:   map[string]string{},
+	}
+}
+
+// Prepare records (and backs up) the state of localFile before it's written.
+func (r *Rollback) Prepare(localPath, localFile string) error {
+	if _, ok := r.Restore[localFile]; ok {
+		return nil
+	}
+
+	// Record directories which don't exist yet, from the top down
+	missing := []string{}
+	for dir := filepath.Dir(localFile); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(longPath(dir)); !os.IsNotExist(err) || dir == filepath.Dir(dir) {
+			break
+		}
+		missing = append([]string{dir}, missing...)
+	}
+	r.Created = append(r.Created, missing...)
+
+	backedUp, err := backupFile(r.BackupDir, localPath, localFile)
+	if err != nil {
+		return err
+	}
+	if backedUp {
+		r.Restore[localFile] = filepath.Join(r.BackupDir, filepath.FromSlash(localPath))
+	} else {
+		r.Created = append(r.Created, localFile)
+	}
+	return nil
+}
+
+// Rollback restores ./vendor/ to its state before the run. It's best effort,
+// all files are attempted and the first error is returned.
+func (r *Rollback) Rollback() error {
+	var firstErr error
+	setErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for localFile, backupPath := range r.Restore {
+		// The file's dir may have been pruned
+		setErr(mkdirAll(filepath.Dir(localFile)))
+		_, err := copyFile(backupPath, localFile)
+		setErr(err)
+	}
+	for i := len(r.Created) - 1; i >= 0; i-- {
+		err := os.Remove(longPath(r.Created[i]))
+		if !os.IsNotExist(err) {
+			setErr(err)
+		}
+	}
+	return firstErr
+}
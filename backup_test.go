@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// snapshotTree returns the files and dirs below dir, with the contents of
+// files.
+func snapshotTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		if info.IsDir() {
+			tree[filepath.ToSlash(rel)+"/"] = ""
+			return nil
+		}
+		data, err := ioutil.ReadFile(p)
+		tree[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestRollbackCopyError(t *testing.T) {
+	modCache := t.TempDir()
+	t.Setenv("GOMODCACHE", modCache)
+	modDir := filepath.Join(modCache, "github.com", "a", "b@v1.0.0")
+	writeTree(t, modDir, "a.h", "c.h", "new/b.h")
+	modules := parseTestModulesTxt(t, "# github.com/a/b v1.0.0\ngithub.com/a/b\n")
+	modules[0].CopyPat = []string{"**/*.h"}
+	vendorModFiles(t, modules[0])
+
+	// The previous run vendored other contents, and another file
+	vendorDir := filepath.Join(t.TempDir(), "vendor")
+	writeTree(t, vendorDir, "modules.txt", "github.com/a/b/old.h")
+	if err := ioutil.WriteFile(filepath.Join(vendorDir, "github.com", "a", "b", "a.h"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshotTree(t, vendorDir)
+
+	actions, err := planCopy(modules, vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// c.h disappears after planning, so copying it fails midway
+	if err := os.Remove(filepath.Join(modDir, "c.h")); err != nil {
+		t.Fatal(err)
+	}
+	failures := []string{}
+	fail := func(code int, format string, args ...interface{}) {
+		if code != exitCopy {
+			t.Errorf("got exit code %d, want %d", code, exitCopy)
+		}
+		failures = append(failures, format)
+	}
+	rollback := newRollback(t.TempDir())
+	files, _ := applyCopy(actions, vendorDir, rollback, nil, fail)
+	if files != 2 || len(failures) != 1 {
+		t.Fatalf("copied %d files with failures %v, want 2 copied and c.h failed", files, failures)
+	}
+	if after := snapshotTree(t, vendorDir); reflect.DeepEqual(after, before) {
+		t.Fatal("nothing was copied before the failure")
+	}
+
+	if err := rollback.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if after := snapshotTree(t, vendorDir); !reflect.DeepEqual(after, before) {
+		got, want := []string{}, []string{}
+		for p, data := range after {
+			got = append(got, p+"="+data)
+		}
+		for p, data := range before {
+			want = append(want, p+"="+data)
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		t.Errorf("got tree %s after the rollback, want %s", strings.Join(got, " "), strings.Join(want, " "))
+	}
+}
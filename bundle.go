@@ -0,0 +1,140 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// writeBundle writes the files, given relative to the project dir, as a
+// gzipped tar.
+func writeBundle(w io.Writer, files []string) error {
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	for _, file := range sorted {
+		name := filepath.ToSlash(filepath.Clean(file))
+		if !bundlePathOK(name) {
+			return fmt.Errorf("%s is outside of the project dir", file)
+		}
+		if err := addBundleFile(tw, file, name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func addBundleFile(tw *tar.Writer, file, name string) error {
+	f, err := os.Open(longPath(file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// bundlePathOK reports whether the slash separated path stays within the
+// project dir.
+func bundlePathOK(name string) bool {
+	return name != "" && !path.IsAbs(name) && !filepath.IsAbs(name) &&
+		name != ".." && !strings.HasPrefix(name, "../") && path.Clean(name) == name
+}
+
+// bundleRoots returns the slash separated, project relative paths bundles
+// may restore files to: the vendor dir and the -copy-to dirs, with a trailing
+// slash, and the manifest, if any.
+func bundleRoots(vendorDir, manifest string) []string {
+	roots := []string{filepath.ToSlash(filepath.Clean(vendorDir)) + "/"}
+	for _, g := range copyGroups {
+		roots = append(roots, filepath.ToSlash(g.Dir)+"/")
+	}
+	if manifest != "" {
+		roots = append(roots, filepath.ToSlash(filepath.Clean(manifest)))
+	}
+	return roots
+}
+
+// bundleEntryAllowed reports whether the bundle entry is below one of the
+// root dirs, or one of the root files.
+func bundleEntryAllowed(name string, roots []string) bool {
+	for _, root := range roots {
+		if root == "./" {
+			continue
+		}
+		if name == root || strings.HasSuffix(root, "/") && strings.HasPrefix(name, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractBundle extracts a bundle written by writeBundle into dir, returning
+// the extracted files. Entries other than the roots and files below them
+// are rejected, so a tampered bundle can't overwrite other project files.
+func extractBundle(r io.Reader, dir string, roots []string) ([]string, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	files := []string{}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !bundlePathOK(hdr.Name) {
+			return nil, fmt.Errorf("invalid bundle entry %q", hdr.Name)
+		}
+		if !bundleEntryAllowed(hdr.Name, roots) {
+			return nil, fmt.Errorf("bundle entry %s is outside of %s", hdr.Name, strings.Join(roots, ", "))
+		}
+		file := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if err := mkdirAll(filepath.Dir(file)); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(longPath(file), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		os.Chtimes(longPath(file), hdr.ModTime, hdr.ModTime)
+		files = append(files, file)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testBundle returns a gzipped tar with the given entries, as a tampered
+// bundle could have them.
+func testBundle(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractBundleRoots(t *testing.T) {
+	roots := []string{"vendor/", "third_party/", "modvendor.json"}
+	for _, test := range []struct {
+		names []string
+		ok    bool
+	}{
+		{[]string{"vendor/github.com/a/b/x.h", "third_party/github.com/a/b/x.c", "modvendor.json"}, true},
+		{[]string{"vendor/x.h", "go.mod"}, false},
+		{[]string{".github/workflows/ci.yml"}, false},
+		{[]string{"vendorx/x.h"}, false},
+		{[]string{"modvendor.json/x"}, false},
+		{[]string{"vendor/../go.mod"}, false},
+	} {
+		dir := t.TempDir()
+		files, err := extractBundle(bytes.NewReader(testBundle(t, test.names...)), dir, roots)
+		if test.ok {
+			if err != nil || len(files) != len(test.names) {
+				t.Errorf("%v: got %v, %v, want all files extracted", test.names, files, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: got no error", test.names)
+		}
+		for _, name := range []string{"go.mod", ".github", "vendorx"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+				t.Errorf("%v: %s was extracted", test.names, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/goware/modvendor/vendorplan"
+	"github.com/mattn/go-zglob/fastwalk"
+)
+
+// globCacheVersion is bumped whenever the glob semantics change, to
+// invalidate previously cached results
+const globCacheVersion = "2"
+
+// inModCache reports whether the module is read from the module cache, whose
+// contents for a given module@version are immutable.
+func inModCache(mod *Mod) bool {
+	return mod.SourcePath == "" || mod.SourceVersion != ""
+}
+
+func globCachePath(cacheDir string, mod *Mod, copyPat []string, pkgs vendorplan.PkgFilter) string {
+	h := sha256.New()
+	h.Write([]byte(globCacheVersion + "\x00" + mod.Dir + "\x00" + strings.Join(copyPat, "\x00")))
+	if pkgs != nil {
+		h.Write([]byte("\x00pkgs\x00" + strings.Join(pkgs, "\x00")))
+	}
+	return filepath.Join(cacheDir, "glob", hex.EncodeToString(h.Sum(nil)))
+}
+
+// cachedGlobModFiles returns vendorplan.Glob results from the cache dir if
+// present, otherwise globs the module and caches the results.
+func cachedGlobModFiles(cacheDir string, mod *Mod, copyPat []string, maxMatches int, pkgs vendorplan.PkgFilter) (map[string]bool, error) {
+	if cacheDir == "" || !inModCache(mod) {
+		return vendorplan.Glob(mod.Dir, copyPat, maxMatches, pkgs)
+	}
+
+	cachePath := globCachePath(cacheDir, mod, copyPat, pkgs)
+	if f, err := os.Open(cachePath); err == nil {
+		defer f.Close()
+		matches := map[string]bool{}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			matches[filepath.Join(mod.Dir, filepath.FromSlash(scanner.Text()))] = false
+		}
+		if scanner.Err() == nil {
+			return matches, vendorplan.CheckMaxMatches(mod.Dir, copyPat, matches, maxMatches)
+		}
+	}
+
+	matches, err := vendorplan.Glob(mod.Dir, copyPat, maxMatches, pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Failing to write the cache isn't fatal, the next run just globs again
+	relPaths := []string{}
+	for m := range matches {
+		relPath, _ := modRelPath(mod, m)
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+	writeCacheFile(cachePath, relPaths)
+
+	return matches, nil
+}
+
+// writeCacheFile atomically writes lines to the cache file. Failing to write
+// the cache isn't fatal, so errors are ignored.
+func writeCacheFile(cachePath string, lines []string) {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(cachePath), "tmp")
+	if err != nil {
+		return
+	}
+	// Temporary files are created 0600
+	err = tmp.Chmod(0644)
+	if err == nil {
+		_, err = tmp.WriteString(strings.Join(append(lines, ""), "\n"))
+	}
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), cachePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// patternExtensions returns the lowercased file extensions the copy patterns
+// are limited to, ie. ".c" and ".h" for "**/*.c include/*.h", or false if any
+// pattern can match files of any extension.
+func patternExtensions(copyPat []string) (map[string]bool, bool) {
+	exts := map[string]bool{}
+	for _, pat := range copyPat {
+		ext := path.Ext(pat)
+		if len(ext) < 2 || strings.ContainsAny(ext, "*?[]{}\\/") {
+			return nil, false
+		}
+		exts[strings.ToLower(ext)] = true
+	}
+	return exts, len(exts) > 0
+}
+
+// cachedModExtensions returns the lowercased extensions of all files of the
+// module, from the cache dir if present, otherwise walking the module and
+// caching them. As module cache contents are immutable, this lets runs with
+// other patterns skip walking modules which have no files they could match.
+func cachedModExtensions(cacheDir string, mod *Mod) (map[string]bool, error) {
+	h := sha256.New()
+	h.Write([]byte(globCacheVersion + "\x00" + mod.Dir))
+	cachePath := filepath.Join(cacheDir, "ext", hex.EncodeToString(h.Sum(nil)))
+
+	exts := map[string]bool{}
+	if data, err := ioutil.ReadFile(cachePath); err == nil {
+		for _, ext := range strings.Split(string(data), "\n") {
+			exts[ext] = true
+		}
+		return exts, nil
+	}
+
+	var mu sync.Mutex
+	err := fastwalk.FastWalk(mod.Dir, func(p string, typ os.FileMode) error {
+		if typ.IsDir() {
+			if p == mod.Dir {
+				return nil
+			}
+			if vendorplan.SkipDirs[filepath.Base(p)] {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		mu.Lock()
+		exts[strings.ToLower(filepath.Ext(p))] = true
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	for ext := range exts {
+		lines = append(lines, ext)
+	}
+	sort.Strings(lines)
+	writeCacheFile(cachePath, lines)
+	return exts, nil
+}
+
+// cannotMatch reports whether the module has no files with the extensions
+// the copy patterns are limited to, if they are. Modules outside of the
+// module cache aren't indexed, as their contents can change.
+func cannotMatch(cacheDir string, mod *Mod, copyPat []string) bool {
+	patExts, ok := patternExtensions(copyPat)
+	if !ok || cacheDir == "" || !inModCache(mod) || mod.Zip != nil {
+		return false
+	}
+	modExts, err := cachedModExtensions(cacheDir, mod)
+	if err != nil {
+		return false
+	}
+	for ext := range patExts {
+		if modExts[ext] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Case collision strategies, for files whose ./vendor/ paths differ only by
+// case (or unicode normalization), which would overwrite each other on
+// case-insensitive filesystems.
+const (
+	collisionWarn   = "warn"   // report collisions only
+	collisionSuffix = "suffix" // append a number to the file name, ie. Foo.h.1
+	collisionRename = "rename" // insert a number before the extension, ie. Foo_1.h
+	collisionFail   = "fail"   // report collisions and fail
+)
+
+type caseCollision struct {
+	Paths   []string          // colliding ./vendor/ relative paths
+	Renamed map[string]string // path -> new path, per strategy
+}
+
+// resolveCaseCollisions finds vendor paths across modules which differ only
+// by case, and renames all but the first (in sorted order) of each set
+// according to strategy.
+func resolveCaseCollisions(modules []*Mod, strategy string) []caseCollision {
+	type entry struct {
+		mod        *Mod
+		vendorFile string
+	}
+	entries := map[string]entry{}
+	paths := []string{}
+	taken := map[string]bool{}
+	for _, mod := range modules {
+		for vendorFile, localPath := range mod.VendorPaths {
+			entries[localPath] = entry{mod, vendorFile}
+			paths = append(paths, localPath)
+			taken[collisionKey(localPath)] = true
+		}
+	}
+	sort.Strings(paths)
+
+	groups := map[string][]string{}
+	keys := []string{}
+	for _, p := range paths {
+		key := collisionKey(p)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], p)
+	}
+
+	collisions := []caseCollision{}
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		collision := caseCollision{Paths: group, Renamed: map[string]string{}}
+
+		if strategy == collisionSuffix || strategy == collisionRename {
+			for _, p := range group[1:] {
+				newPath := ""
+				for n := 1; newPath == "" || taken[collisionKey(newPath)]; n++ {
+					newPath = collisionPath(p, n, strategy)
+				}
+				taken[collisionKey(newPath)] = true
+
+				e := entries[p]
+				e.mod.VendorPaths[e.vendorFile] = newPath
+				collision.Renamed[p] = newPath
+			}
+		}
+		collisions = append(collisions, collision)
+	}
+
+	return collisions
+}
+
+// collisionKey is equal for paths which map to the same file on case and
+// normalization insensitive filesystems
+func collisionKey(p string) string {
+	return strings.ToLower(nfc(p))
+}
+
+func collisionPath(p string, n int, strategy string) string {
+	if strategy == collisionSuffix {
+		return fmt.Sprintf("%s.%d", p, n)
+	}
+	ext := path.Ext(p)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(p, ext), n, ext)
+}
+
+// involves returns whether any of the colliding paths is in paths.
+func (c caseCollision) involves(paths map[string]bool) bool {
+	for _, p := range c.Paths {
+		if paths[p] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c caseCollision) String() string {
+	s := "case collision: " + strings.Join(c.Paths, ", ")
+	renames := []string{}
+	for _, p := range c.Paths {
+		if newPath, ok := c.Renamed[p]; ok {
+			renames = append(renames, fmt.Sprintf("%s → %s", p, newPath))
+		}
+	}
+	if len(renames) > 0 {
+		s += " (renamed " + strings.Join(renames, ", ") + ")"
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+)
+
+// stdout is where all output goes, colorized by setupColor as per -color.
+var stdout io.Writer = os.Stdout
+
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorBold   = "\x1b[1m"
+	colorReset  = "\x1b[0m"
+)
+
+// colorPrefixes are the line prefixes colorized in output
+var colorPrefixes = []struct {
+	re    *regexp.Regexp
+	color string
+}{
+	{regexp.MustCompile(`^Error!`), colorRed},
+	{regexp.MustCompile(`^Whoops,`), colorRed},
+	{regexp.MustCompile(`^Warning!`), colorYellow},
+	{regexp.MustCompile(`^\d+ failures:`), colorBold + colorRed},
+}
+
+// setupColor sets up colorized stdout for -color=always, or for auto if
+// stdout is a terminal and NO_COLOR isn't set.
+func setupColor(mode string) {
+	switch mode {
+	case "never":
+		return
+	case "auto":
+		if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" || !isTerminal(os.Stdout) {
+			return
+		}
+	}
+	stdout = &colorWriter{w: os.Stdout, lineStart: true}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorWriter colorizes the known prefixes of lines written to w.
+type colorWriter struct {
+	w         io.Writer
+	lineStart bool
+}
+
+func (cw *colorWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	var buf bytes.Buffer
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+		}
+		p = p[len(line):]
+
+		if cw.lineStart {
+			for _, cp := range colorPrefixes {
+				if loc := cp.re.FindIndex(line); loc != nil {
+					buf.WriteString(cp.color)
+					buf.Write(line[:loc[1]])
+					buf.WriteString(colorReset)
+					line = line[loc[1]:]
+					break
+				}
+			}
+		}
+		buf.Write(line)
+		cw.lineStart = line[len(line)-1] == '\n'
+	}
+	_, err := cw.w.Write(buf.Bytes())
+	return n, err
+}
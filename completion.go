@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// moduleFlags take a module path as (the start of) their value.
+var moduleFlags = []string{"-all-files", "-asset-modules", "-override", "-source-dir", "-strip"}
+
+// Completion scripts, with @COMMANDS@, @FLAGS@ and @MODULE_FLAGS@ replaced
+// by space separated lists. Module names are completed by running
+// `modvendor completion modules`, listing those of the project in the
+// current directory.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for modvendor, ie. source <(modvendor completion bash)
+_modvendor() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+	# "=" is a word break, so -strip=foo is split into "-strip" "=" "foo"
+	if [[ $cur == "=" ]]; then
+		cur=""
+	elif [[ $prev == "=" ]]; then
+		prev="${COMP_WORDS[COMP_CWORD-2]}"
+	else
+		prev=""
+	fi
+	local f
+	for f in @MODULE_FLAGS@; do
+		if [[ $prev == "$f" ]]; then
+			COMPREPLY=($(compgen -W "$(modvendor completion modules 2>/dev/null)" -- "$cur"))
+			return
+		fi
+	done
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "@FLAGS@" -- "$cur"))
+	elif [[ $COMP_CWORD -eq 1 ]]; then
+		COMPREPLY=($(compgen -W "@COMMANDS@" -- "$cur"))
+	elif [[ ${COMP_WORDS[1]} == diff-module && $COMP_CWORD -eq 2 ]]; then
+		COMPREPLY=($(compgen -W "$(modvendor completion modules 2>/dev/null)" -- "$cur"))
+	elif [[ ${COMP_WORDS[1]} == completion && $COMP_CWORD -eq 2 ]]; then
+		COMPREPLY=($(compgen -W "bash zsh fish powershell" -- "$cur"))
+	fi
+}
+complete -o default -F _modvendor modvendor
+`,
+
+	"zsh": `#compdef modvendor
+# zsh completion for modvendor, ie. source <(modvendor completion zsh)
+_modvendor() {
+	local cur="${words[CURRENT]}" f
+	for f in @MODULE_FLAGS@; do
+		if [[ $cur == $f=* ]]; then
+			compset -P '*='
+			compadd -- ${(f)"$(modvendor completion modules 2>/dev/null)"}
+			return
+		fi
+	done
+	if [[ $cur == -* ]]; then
+		compadd -- @FLAGS@
+	elif (( CURRENT == 2 )); then
+		compadd -- @COMMANDS@
+	elif [[ ${words[2]} == diff-module ]] && (( CURRENT == 3 )); then
+		compadd -- ${(f)"$(modvendor completion modules 2>/dev/null)"}
+	elif [[ ${words[2]} == completion ]] && (( CURRENT == 3 )); then
+		compadd -- bash zsh fish powershell
+	else
+		_files
+	fi
+}
+compdef _modvendor modvendor
+`,
+
+	"fish": `# fish completion for modvendor, ie. modvendor completion fish | source
+complete -c modvendor -f -n '__fish_use_subcommand' -a '@COMMANDS@'
+complete -c modvendor -f -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish powershell'
+complete -c modvendor -f -n '__fish_seen_subcommand_from diff-module' -a '(modvendor completion modules 2>/dev/null)'
+for f in @FLAGS@
+	set -l name (string sub -s 2 -- $f)
+	if contains -- $f @MODULE_FLAGS@
+		complete -c modvendor -o $name -x -a '(modvendor completion modules 2>/dev/null)'
+	else
+		complete -c modvendor -o $name
+	end
+end
+`,
+
+	"powershell": `# powershell completion for modvendor, ie.
+# modvendor completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName modvendor -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = $commandAst.CommandElements | ForEach-Object { $_.ToString() }
+	$candidates = @()
+	$prefix = ''
+	$word = "$wordToComplete"
+	if ($word -match '^(-[a-z-]+)=(.*)$' -and (@('@MODULE_FLAGS@'.Split(' ')) -contains $Matches[1])) {
+		$prefix = $Matches[1] + '='
+		$word = $Matches[2]
+		$candidates = @(modvendor completion modules 2>$null)
+	} elseif ($word.StartsWith('-')) {
+		$candidates = '@FLAGS@'.Split(' ')
+	} elseif ($words.Count -le 2) {
+		$candidates = '@COMMANDS@'.Split(' ')
+	} elseif ($words[1] -eq 'diff-module') {
+		$candidates = @(modvendor completion modules 2>$null)
+	} elseif ($words[1] -eq 'completion') {
+		$candidates = 'bash', 'zsh', 'fish', 'powershell'
+	}
+	$candidates | Where-Object { $_ -like "$word*" } | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($prefix + $_, $_, 'ParameterValue', $_)
+	}
+}
+`,
+}
+
+// writeCompletion writes the completion script of the shell, or with
+// "modules" the module paths of the project in the current dir, one per line.
+func writeCompletion(w io.Writer, shell string) error {
+	if shell == "modules" {
+		vendorDir := *vendorDirFlag
+		if vendorDir == "" {
+			vendorDir = detectVendorDir()
+		}
+		// Outside of a vendored project there's just nothing to complete
+		modules, _ := parseModulesTxt(filepath.Join(vendorDir, "modules.txt"))
+		for _, mod := range modules {
+			fmt.Fprintln(w, mod.ImportPath)
+		}
+		return nil
+	}
+
+	script, ok := completionScripts[shell]
+	if !ok {
+		shells := []string{}
+		for s := range completionScripts {
+			shells = append(shells, s)
+		}
+		sort.Strings(shells)
+		return fmt.Errorf("completion needs a shell, one of %s", strings.Join(shells, ", "))
+	}
+	flagNames := []string{}
+	flags.VisitAll(func(f *flag.Flag) {
+		flagNames = append(flagNames, "-"+f.Name)
+	})
+	r := strings.NewReplacer(
+		"@COMMANDS@", strings.Join(commands, " "),
+		"@FLAGS@", strings.Join(flagNames, " "),
+		"@MODULE_FLAGS@", strings.Join(moduleFlags, " "),
+	)
+	_, err := io.WriteString(w, r.Replace(script))
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// fileMode is the mode of copied files from -file-mode, or 0 to derive it
+// from the source file, made owner-writable.
+var fileMode os.FileMode
+
+// copyFile copies the regular file src to dst, with the -file-mode.
+func copyFile(src, dst string) (int64, error) {
+	return vendorplan.CopyFile(longPath(src), longPath(dst), fileMode)
+}
+
+// dirMode is the mode of directories created for copied files, from
+// -dir-mode, or 0 for 0755 subject to the umask.
+var dirMode os.FileMode
+
+// mkdirAll creates dir for copied files along with any missing parents.
+func mkdirAll(dir string) error {
+	missing := []string{}
+	parent := dir
+	for ; ; parent = filepath.Dir(parent) {
+		if _, err := os.Stat(longPath(parent)); err == nil || filepath.Dir(parent) == parent {
+			break
+		}
+		missing = append(missing, parent)
+	}
+	if err := os.MkdirAll(longPath(dir), 0755); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if dirMode != 0 {
+			if err := os.Chmod(longPath(d), dirMode); err != nil {
+				return err
+			}
+		}
+		if owner != nil {
+			if err := owner.chown(d, parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
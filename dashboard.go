@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressReporter is notified of the progress of the copy phase.
+type progressReporter interface {
+	Copying(action *CopyAction)
+	Copied(action *CopyAction, n int64)
+	Message(msg string) // warnings and errors
+	Done()
+}
+
+// dashboard is the -progress terminal UI, redrawn in place with ANSI escapes
+// while copying: per module progress, the current file, throughput and the
+// messages reported so far.
+type dashboard struct {
+	out io.Writer
+
+	mu       sync.Mutex
+	start    time.Time
+	modules  []string
+	total    map[string]int // module -> files to copy
+	done     map[string]int // module -> files copied
+	bytes    int64
+	current  string
+	messages []string
+	lines    int // lines drawn last time, to move back up over
+	drawn    time.Time
+}
+
+const dashboardMaxMessages = 5
+
+func newDashboard(out io.Writer, actions []*CopyAction) *dashboard {
+	d := &dashboard{
+		out:   out,
+		start: time.Now(),
+		total: map[string]int{},
+		done:  map[string]int{},
+	}
+	for _, action := range actions {
+		if _, ok := d.total[action.Module]; !ok {
+			d.modules = append(d.modules, action.Module)
+		}
+		d.total[action.Module]++
+	}
+	sort.Strings(d.modules)
+	return d
+}
+
+func (d *dashboard) Copying(action *CopyAction) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.current = action.Destination
+	d.draw(false)
+}
+
+func (d *dashboard) Copied(action *CopyAction, n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.done[action.Module]++
+	d.bytes += n
+	d.draw(false)
+}
+
+// Message records a warning or error, printed as part of the dashboard.
+func (d *dashboard) Message(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.messages = append(d.messages, msg)
+	d.draw(true)
+}
+
+func (d *dashboard) Done() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.current = ""
+	d.draw(true)
+}
+
+// draw redraws the dashboard, at most every 100ms unless forced.
+func (d *dashboard) draw(force bool) {
+	if !force && time.Since(d.drawn) < 100*time.Millisecond {
+		return
+	}
+	d.drawn = time.Now()
+
+	var b strings.Builder
+	if d.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", d.lines)
+	}
+	lines := []string{}
+	for _, mod := range d.modules {
+		done, total := d.done[mod], d.total[mod]
+		bar := strings.Repeat("#", done*20/total) + strings.Repeat(" ", 20-done*20/total)
+		lines = append(lines, fmt.Sprintf("[%s] %d/%d %s", bar, done, total, mod))
+	}
+	elapsed := time.Since(d.start).Seconds()
+	throughput := 0.0
+	if elapsed > 0 {
+		throughput = float64(d.bytes) / elapsed / (1 << 20)
+	}
+	if d.current != "" {
+		lines = append(lines, fmt.Sprintf("%.1f MB/s, copying %s", throughput, d.current))
+	} else {
+		lines = append(lines, fmt.Sprintf("%.1f MB/s, done in %s", throughput, time.Since(d.start).Round(time.Millisecond)))
+	}
+	messages := d.messages
+	if len(messages) > dashboardMaxMessages {
+		lines = append(lines, fmt.Sprintf("(%d earlier messages)", len(messages)-dashboardMaxMessages))
+		messages = messages[len(messages)-dashboardMaxMessages:]
+	}
+	lines = append(lines, messages...)
+
+	for _, line := range lines {
+		b.WriteString("\x1b[2K" + line + "\n")
+	}
+	// Clear what's left of a previous, longer, dashboard
+	for i := len(lines); i < d.lines; i++ {
+		b.WriteString("\x1b[2K\n")
+	}
+	if d.lines > len(lines) {
+		fmt.Fprintf(&b, "\x1b[%dA", d.lines-len(lines))
+	}
+	d.lines = len(lines)
+	io.WriteString(d.out, b.String())
+}
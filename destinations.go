@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// copyGroup is an additional destination dir for the files matching its
+// patterns, as given by -copy-to=<dir>=<patterns>.
+type copyGroup struct {
+	Dir      string
+	Patterns []string
+}
+
+type copyGroupsFlag []copyGroup
+
+func (f *copyGroupsFlag) String() string {
+	groups := []string{}
+	for _, g := range *f {
+		groups = append(groups, g.Dir+"="+strings.Join(g.Patterns, " "))
+	}
+	return strings.Join(groups, ", ")
+}
+
+func (f *copyGroupsFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 || len(strings.Fields(value[i+1:])) == 0 {
+		return fmt.Errorf("expected <dir>=<patterns>, ie. third_party=\"**/*.c **/*.h\"")
+	}
+	*f = append(*f, copyGroup{Dir: filepath.Clean(value[:i]), Patterns: strings.Fields(value[i+1:])})
+	return nil
+}
+
+// dirs returns the destination dirs of the groups.
+func (f copyGroupsFlag) dirs() []string {
+	dirs := []string{}
+	for _, g := range f {
+		dirs = append(dirs, g.Dir)
+	}
+	return dirs
+}
+
+// planDestinations copies the planned actions into each destination dir with
+// matching patterns in mod.DestPat. Files only matching -copy-to patterns are
+// dropped from their module's vendor list, which only tracks ./vendor/.
+func planDestinations(actions []*CopyAction, vendorDir string) []*CopyAction {
+	planned := []*CopyAction{}
+	for _, action := range actions {
+		mod := action.mod
+		for _, dir := range destDirs(mod, vendorDir) {
+			if !matchesAny(mod, mod.DestPat[dir], action.vendorFile) {
+				if dir == vendorDir {
+					delete(mod.VendorList, action.vendorFile)
+				}
+				continue
+			}
+			a := *action
+			a.Dir = dir
+			planned = append(planned, &a)
+		}
+	}
+	sortActions(planned)
+	return planned
+}
+
+// destDirs returns the destination dirs of the module, ./vendor/ first.
+func destDirs(mod *Mod, vendorDir string) []string {
+	dirs := []string{vendorDir}
+	for dir := range mod.DestPat {
+		if dir != vendorDir {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs[1:])
+	return dirs
+}
+
+func matchesAny(mod *Mod, patterns []string, vendorFile string) bool {
+	for _, pat := range patterns {
+		if vendorplan.MatchPattern(mod.Dir, pat, vendorFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// rollbackPath is the path under the backup dir of a file in the given
+// destination dir. Files in ./vendor/ keep their vendor relative paths.
+func rollbackPath(dir, vendorDir, localPath string) string {
+	if dir == vendorDir {
+		return localPath
+	}
+	return path.Join(filepath.ToSlash(dir), localPath)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// downloadModule downloads the module version into the module cache with
+// `go mod download`, if not there already.
+func downloadModule(importPath, version string) (*Mod, error) {
+	// Errors are reported in the JSON output, along with a non-zero exit
+	cmd := exec.Command("go", "mod", "download", "-json", importPath+"@"+version)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("go mod download: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var m struct {
+		Path, Version, Dir, Error string
+	}
+	if err := json.Unmarshal(out, &m); err != nil {
+		return nil, fmt.Errorf("go mod download: %v", err)
+	}
+	if m.Error != "" {
+		return nil, fmt.Errorf("go mod download: %s", m.Error)
+	}
+	return &Mod{ModuleInfo: vendorplan.ModuleInfo{ImportPath: m.Path, Version: m.Version, Dir: m.Dir}}, nil
+}
+
+// moduleFileDiff is a file matching the copy patterns in either version of
+// a module, by module relative path.
+type moduleFileDiff struct {
+	Path   string
+	Status string // added, removed or modified
+	Old    string // file in the old version, "" if added
+	New    string // file in the new version, "" if removed
+}
+
+// diffModuleFiles compares the files of two versions of a module matching
+// their copy patterns, returning those added, removed or modified.
+func diffModuleFiles(oldMod, newMod *Mod) ([]moduleFileDiff, error) {
+	files := map[string]*moduleFileDiff{}
+	for _, mod := range []*Mod{oldMod, newMod} {
+		vendorList, err := buildModVendorList(mod)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %v", mod, err)
+		}
+		for vendorFile := range vendorList {
+			relPath, _ := modRelPath(mod, vendorFile)
+			d, ok := files[relPath]
+			if !ok {
+				d = &moduleFileDiff{Path: relPath}
+				files[relPath] = d
+			}
+			if mod == oldMod {
+				d.Old = vendorFile
+			} else {
+				d.New = vendorFile
+			}
+		}
+	}
+
+	diffs := []moduleFileDiff{}
+	for _, d := range files {
+		switch {
+		case d.Old == "":
+			d.Status = "added"
+		case d.New == "":
+			d.Status = "removed"
+		default:
+			same, err := sameFiles(d.Old, d.New)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+			d.Status = "modified"
+		}
+		diffs = append(diffs, *d)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs, nil
+}
+
+func sameFiles(a, b string) (bool, error) {
+	sums := [2]string{}
+	for i, file := range []string{a, b} {
+		f, err := os.Open(longPath(file))
+		if err != nil {
+			return false, err
+		}
+		sums[i], err = readerSHA256(f)
+		f.Close()
+		if err != nil {
+			return false, err
+		}
+	}
+	return sums[0] == sums[1], nil
+}
+
+// printModuleDiff lists the changed files, followed by the unified diff of
+// each using the system's diff command, if there's one.
+func printModuleDiff(w io.Writer, oldMod, newMod *Mod, diffs []moduleFileDiff) {
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%-9s %s\n", d.Status, d.Path)
+	}
+	if _, err := exec.LookPath("diff"); err != nil {
+		return
+	}
+	for _, d := range diffs {
+		oldFile, newFile := d.Old, d.New
+		if oldFile == "" {
+			oldFile = os.DevNull
+		}
+		if newFile == "" {
+			newFile = os.DevNull
+		}
+		cmd := exec.Command("diff", "-u",
+			"--label", oldMod.ImportPath+"@"+oldMod.Version+"/"+d.Path,
+			"--label", newMod.ImportPath+"@"+newMod.Version+"/"+d.Path,
+			oldFile, newFile)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Run() // diff exits 1 when the files differ
+		fmt.Fprintln(w)
+		w.Write(out.Bytes())
+	}
+}
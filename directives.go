@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// parseGoModDirectives reads the `// modvendor:copy <module> <patterns...>`
+// comment directives from go.mod, either on their own line or trailing a
+// require line, ie.
+//
+//	require (
+//		github.com/pganalyze/pg_query_go v1.0.0 // modvendor:copy github.com/pganalyze/pg_query_go **/*.c **/*.h
+//	)
+//
+// It returns the copy patterns per module import path.
+func parseGoModDirectives(gomodPath string) (map[string][]string, error) {
+	f, err := os.Open(gomodPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	modCopyPat := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		i := strings.Index(line, "//")
+		if i < 0 {
+			continue
+		}
+		s := strings.Fields(line[i+2:])
+		if len(s) == 0 || s[0] != "modvendor:copy" {
+			continue
+		}
+		s = s[1:]
+		if len(s) < 2 {
+			return nil, fmt.Errorf("%s:%d: modvendor:copy directive needs a module and at least one pattern", gomodPath, n)
+		}
+		modCopyPat[s[0]] = append(modCopyPat[s[0]], s[1:]...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return modCopyPat, nil
+}
+
+// parseSourceDirectives scans the Go files of the project's packages, as
+// reported by go list, for `//go:modvendor copy <module> <patterns...>`
+// directives, which like go:generate must start at the beginning of a line.
+// Packages within the skip dirs, ie. the vendor dir and the previous one
+// left by sync, the -copy-to and -backup dirs, aren't scanned. If go list
+// fails, the project dir is walked instead, also skipping
+// vendorplan.SkipDirs, testdata and nested modules. It returns the copy
+// patterns per module import path.
+func parseSourceDirectives(dir string, skip []string) (map[string][]string, error) {
+	files, err := listSourceFiles(dir, skip)
+	if err != nil {
+		files, err = walkSourceFiles(dir, skip)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	modCopyPat := map[string][]string{}
+	for _, path := range files {
+		if err := scanSourceDirectives(dir, path, modCopyPat); err != nil {
+			return nil, err
+		}
+	}
+	return modCopyPat, nil
+}
+
+// inSkipDir reports whether path is one of the skip dirs or below one.
+func inSkipDir(path string, skip []string) bool {
+	for _, s := range skip {
+		if path == s || strings.HasPrefix(path, s+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// listSourceFiles returns the Go files in the dirs of the project's
+// packages.
+func listSourceFiles(dir string, skip []string) ([]string, error) {
+	out, err := goCmdIn(dir, "list", "-e", "-f", "{{.Dir}}", "./...")
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, pkgDir := range strings.Split(string(out), "\n") {
+		if pkgDir == "" || inSkipDir(pkgDir, skip) {
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(pkgDir, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// walkSourceFiles returns the Go files below the project dir.
+func walkSourceFiles(dir string, skip []string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == dir {
+				return nil
+			}
+			if inSkipDir(path, skip) || vendorplan.SkipDirs[info.Name()] || info.Name() == "testdata" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".go") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// scanSourceDirectives adds the patterns of the go:modvendor directives of
+// the Go file to modCopyPat.
+func scanSourceDirectives(dir, path string, modCopyPat map[string][]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "//go:modvendor ") {
+			continue
+		}
+		s := strings.Fields(strings.TrimPrefix(line, "//go:modvendor "))
+		if len(s) < 3 || s[0] != "copy" {
+			rel, _ := filepath.Rel(dir, path)
+			return fmt.Errorf("%s:%d: invalid go:modvendor directive, expected //go:modvendor copy <module> <patterns...>", rel, n)
+		}
+		modCopyPat[s[1]] = append(modCopyPat[s[1]], s[2:]...)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSourceDirectivesSkipDirs(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/proj\n\ngo 1.18\n",
+		"main.go": "package main\n\n//go:modvendor copy github.com/a/b **/*.h\n\nfunc main() {}\n",
+	}
+	// Go files in the dirs modvendor writes to carry the directives of
+	// vendored modules, which aren't the project's
+	for _, skipped := range []string{"vendor", "vendor.modvendor-old", "third_party", "backup"} {
+		files[skipped+"/github.com/c/d/d.go"] = "package d\n\n//go:modvendor copy github.com/c/d **/*.c\n"
+	}
+	for name, data := range files {
+		writeTree(t, dir, name)
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	skip := []string{}
+	for _, d := range []string{"vendor", "vendor.modvendor-old", "third_party", "backup"} {
+		skip = append(skip, filepath.Join(dir, d))
+	}
+
+	for name, list := range map[string]func(string, []string) ([]string, error){
+		"go list": listSourceFiles,
+		"walk":    walkSourceFiles,
+	} {
+		files, err := list(dir, skip)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(files) != 1 || files[0] != filepath.Join(dir, "main.go") {
+			t.Errorf("%s: got files %v, want only main.go", name, files)
+		}
+	}
+
+	modCopyPat, err := parseSourceDirectives(dir, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modCopyPat) != 1 || strings.Join(modCopyPat["github.com/a/b"], " ") != "**/*.h" {
+		t.Errorf("got directives %v, want only those of main.go", modCopyPat)
+	}
+}
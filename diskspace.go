@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Free space required on top of the bytes to copy, ie. for filesystem
+// overhead and the backups of overwritten files.
+const (
+	diskSpaceMarginPercent = 10
+	diskSpaceMarginBytes   = 10 << 20
+)
+
+// checkDiskSpace verifies the filesystem of each destination dir has room for
+// the files planned to be copied into it, returning an error for the first
+// one which doesn't. Destinations whose free space can't be determined are
+// skipped.
+func checkDiskSpace(actions []*CopyAction) error {
+	needed := map[string]uint64{}
+	for _, action := range actions {
+		needed[action.Dir] += uint64(action.Size)
+	}
+	dirs := []string{}
+	for dir := range needed {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		free, err := freeSpace(existingParent(dir))
+		if err != nil {
+			continue
+		}
+		want := needed[dir] + needed[dir]*diskSpaceMarginPercent/100 + diskSpaceMarginBytes
+		if free < want {
+			return fmt.Errorf("not enough free space for %s, %s to copy (%s with margin) but only %s available", dir, formatBytes(needed[dir]), formatBytes(want), formatBytes(free))
+		}
+	}
+	return nil
+}
+
+// existingParent returns dir, or its closest parent which exists.
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !linux && !darwin && !freebsd
+// +build !windows,!linux,!darwin,!freebsd
+
+package main
+
+import "errors"
+
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("free space check not supported")
+}
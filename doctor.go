@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// doctorCheck is an item of the `modvendor doctor` checklist.
+type doctorCheck struct {
+	Name   string
+	OK     bool
+	Detail string
+	Hint   string // how to fix it, if failed
+}
+
+// runDoctor checks the environment modvendor runs in: the go command, the
+// module cache, the freshness of modules.txt, the copy patterns and whether
+// all modules are in the module cache.
+func runDoctor(vendorDir, gomodPath string, copyPat []string) []doctorCheck {
+	checks := []doctorCheck{}
+
+	c := doctorCheck{Name: "go command"}
+	if goBin, err := exec.LookPath("go"); err != nil {
+		c.Detail, c.Hint = err.Error(), "install Go and add it to $PATH"
+	} else if out, err := goCmd("version"); err != nil {
+		c.Detail, c.Hint = err.Error(), "check "+goBin+" is a working go binary"
+	} else {
+		c.OK, c.Detail = true, strings.TrimSpace(string(out))
+	}
+	checks = append(checks, c)
+
+	c = doctorCheck{Name: "module cache", Detail: vendorplan.ModCacheDir()}
+	if vendorplan.ModCacheDir() == "" {
+		c.Detail, c.Hint = "neither HOME nor GOPATH is set", "pass -gopath=<dir> or set GOMODCACHE"
+	} else if info, err := os.Stat(vendorplan.ModCacheDir()); err != nil {
+		c.Detail, c.Hint = err.Error(), "set GOPATH, or run `go mod download` to populate the module cache"
+	} else if !info.IsDir() {
+		c.Hint = "GOPATH/pkg/mod must be a directory"
+	} else if !isWritable(vendorplan.ModCacheDir()) {
+		c.OK, c.Detail = true, vendorplan.ModCacheDir()+" (read-only, missing modules can't be downloaded)"
+	} else {
+		c.OK = true
+	}
+	checks = append(checks, c)
+
+	modtxtPath := filepath.Join(vendorDir, "modules.txt")
+	c = doctorCheck{Name: "modules.txt", Detail: modtxtPath}
+	modules, err := parseModulesTxt(modtxtPath)
+	gomod, gomodErr := os.Stat(gomodPath)
+	modtxt, modtxtErr := os.Stat(modtxtPath)
+	switch {
+	case err != nil:
+		c.Detail, c.Hint = err.Error(), "run `go mod vendor`"
+	case gomodErr == nil && modtxtErr == nil && modtxt.ModTime().Before(gomod.ModTime()):
+		c.Detail, c.Hint = modtxtPath+" is older than go.mod", "run `go mod vendor` so they agree"
+	default:
+		c.OK, c.Detail = true, fmt.Sprintf("%s (%d modules)", modtxtPath, len(modules))
+	}
+	checks = append(checks, c)
+
+	c = doctorCheck{Name: "copy patterns", OK: true, Detail: strings.Join(copyPat, " ")}
+	if len(copyPat) == 0 {
+		c.OK, c.Detail, c.Hint = false, "no -copy patterns", "pass -copy, ie. -copy=\"**/*.c **/*.h\", or add modvendor:copy directives to go.mod"
+	}
+	for _, pat := range copyPat {
+		if _, err := vendorplan.CompilePattern("", pat); err != nil {
+			c.OK, c.Detail, c.Hint = false, fmt.Sprintf("pattern %s: %v", pat, err), "fix the pattern syntax"
+			break
+		}
+		if strings.Contains(pat, `\`) || filepath.IsAbs(pat) || strings.HasPrefix(pat, "/") {
+			c.OK, c.Detail, c.Hint = false, "pattern "+pat, "patterns are relative to module roots and always use / as separator"
+			break
+		}
+		if vendorplan.IsAnchoredPattern(pat) {
+			found := false
+			for _, mod := range modules {
+				_, ok := vendorplan.AnchorPattern(mod.ImportPath, pat)
+				found = found || ok
+			}
+			if !found {
+				c.OK, c.Detail, c.Hint = false, "pattern "+pat+" matches no vendored module", "check the import path it starts with"
+				break
+			}
+		}
+	}
+	checks = append(checks, c)
+
+	c = doctorCheck{Name: "modules in cache", OK: true}
+	missing := []string{}
+	withPkgs := 0
+	for _, mod := range modules {
+		if !providesFiles(mod) {
+			continue
+		}
+		withPkgs++
+		if _, err := os.Stat(mod.Dir); os.IsNotExist(err) && findModZip(mod) == nil {
+			missing = append(missing, mod.String())
+		}
+	}
+	if len(missing) > 0 {
+		c.OK, c.Detail, c.Hint = false, fmt.Sprintf("%d missing: %s", len(missing), strings.Join(missing, ", ")), "run `GOFLAGS=-mod=mod go mod download`"
+	} else {
+		c.Detail = fmt.Sprintf("all %d modules with packages or assets present", withPkgs)
+	}
+	checks = append(checks, c)
+
+	return checks
+}
+
+func printDoctor(w io.Writer, checks []doctorCheck) {
+	for _, c := range checks {
+		status := "ok  "
+		if !c.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, c.Name, c.Detail)
+		if !c.OK && c.Hint != "" {
+			fmt.Fprintf(w, "       %s\n", c.Hint)
+		}
+	}
+}
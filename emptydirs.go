@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/goware/modvendor/vendorplan"
+	"github.com/mattn/go-zglob/fastwalk"
+)
+
+// matchedDirs returns the module relative directories matched by the copy
+// patterns themselves, ie. include/sub for "include/**", with the same
+// exclusions as vendorplan.Glob. Module zips have no directory entries, so
+// only the directories of their files can match.
+func matchedDirs(mod *Mod) ([]string, error) {
+	patterns, err := vendorplan.CompilePatterns(mod.Dir, mod.CopyPat)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := modPkgFilter(mod)
+	matches := func(rel string) bool {
+		if !pkgs.Keep(rel + "/") {
+			return false
+		}
+		name := filepath.Join(mod.Dir, filepath.FromSlash(rel))
+		for _, p := range patterns {
+			if p.Match(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	dirs := map[string]bool{}
+	if mod.Zip != nil {
+		if err := mod.Zip.open(); err != nil {
+			return nil, err
+		}
+		for relPath := range mod.Zip.files {
+			for dir := path.Dir(nfc(relPath)); dir != "."; dir = path.Dir(dir) {
+				if matches(dir) {
+					dirs[dir] = true
+				}
+			}
+		}
+	} else {
+		// fastwalk calls back from several goroutines
+		var mu sync.Mutex
+		err = fastwalk.FastWalk(mod.Dir, func(p string, typ os.FileMode) error {
+			if !typ.IsDir() || p == mod.Dir {
+				return nil
+			}
+			rel := nfc(filepath.ToSlash(p[len(mod.Dir)+1:]))
+			if vendorplan.SkipDirs[filepath.Base(p)] || !pkgs.CanKeepBelow(rel) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			if matches(rel) {
+				mu.Lock()
+				dirs[rel] = true
+				mu.Unlock()
+			}
+			segs := strings.Split(rel, "/")
+			for _, pat := range patterns {
+				if pat.CanMatchBelow(segs) {
+					return nil
+				}
+			}
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := []string{}
+	for dir := range dirs {
+		list = append(list, dir)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// keptDirs returns the vendor relative directories to create with
+// -empty-dirs: those matched by the copy patterns, and those of all files in
+// the vendor lists, before any of them get skipped.
+func keptDirs(modules []*Mod) (map[string]bool, error) {
+	keep := map[string]bool{}
+	for _, mod := range modules {
+		if len(mod.CopyPat) == 0 {
+			continue
+		}
+		dirs, err := matchedDirs(mod)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if dest, ok := vendorPath(mod, filepath.Join(mod.Dir, filepath.FromSlash(dir))); ok {
+				keep[dest] = true
+			}
+		}
+		for vendorFile := range mod.VendorList {
+			if localPath, ok := vendorPath(mod, vendorFile); ok {
+				keep[path.Dir(localPath)] = true
+			}
+		}
+	}
+	return keep, nil
+}
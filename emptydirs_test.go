@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// Run with -race: fastwalk calls back from several goroutines, so matchedDirs
+// must not write its results unguarded.
+func TestMatchedDirsConcurrentWalk(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{}
+	for i := 0; i < 200; i++ {
+		files = append(files, fmt.Sprintf("include/d%03d/x.h", i))
+	}
+	writeTree(t, dir, files...)
+
+	mod := &Mod{ModuleInfo: vendorplan.ModuleInfo{ImportPath: "github.com/foo/bar", Dir: dir}, CopyPat: []string{"include/**"}}
+	dirs, err := matchedDirs(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 200 {
+		t.Fatalf("got %d dirs, want 200", len(dirs))
+	}
+	for i, want := range []string{"include/d000", "include/d001"} {
+		if dirs[i] != want {
+			t.Errorf("dirs[%d] = %s, want %s", i, dirs[i], want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// goFlags returns GOFLAGS, as set in the environment or by `go env -w`.
+func goFlags() []string {
+	flags := os.Getenv("GOFLAGS")
+	if out, err := goCmd("env", "GOFLAGS"); err == nil {
+		flags = strings.TrimSpace(string(out))
+	}
+	return strings.Fields(flags)
+}
+
+// envWarnings checks for common misconfigurations, before any work is done:
+// a modules.txt older than go.mod, and modules missing from the module cache
+// which can't be downloaded as things are.
+func envWarnings(modules []*Mod, gomodPath, modtxtPath string) []string {
+	warnings := []string{}
+
+	gomod, err1 := os.Stat(gomodPath)
+	modtxt, err2 := os.Stat(modtxtPath)
+	if err1 == nil && err2 == nil && modtxt.ModTime().Before(gomod.ModTime()) {
+		warnings = append(warnings, fmt.Sprintf("%s is older than go.mod, run `go mod vendor` first so they agree", modtxtPath))
+	}
+
+	missing := 0
+	for _, mod := range modules {
+		if !providesFiles(mod) || !inModCache(mod) {
+			continue
+		}
+		if _, err := os.Stat(mod.Dir); os.IsNotExist(err) && findModZip(mod) == nil {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return warnings
+	}
+	for _, f := range goFlags() {
+		if f == "-mod=vendor" {
+			warnings = append(warnings, fmt.Sprintf("%d modules aren't in the module cache, and GOFLAGS has -mod=vendor so the go command won't download them, run `GOFLAGS=-mod=mod go mod download` first", missing))
+		}
+	}
+	if !isWritable(vendorplan.ModCacheDir()) {
+		warnings = append(warnings, fmt.Sprintf("%d modules aren't in the module cache, which isn't writable (%s), so they can't be downloaded into it", missing, vendorplan.ModCacheDir()))
+	}
+	return warnings
+}
+
+// isWritable reports whether files can be created in dir, ie. it's not on a
+// read-only mount. Dirs which don't exist yet count as writable.
+func isWritable(dir string) bool {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return true
+	}
+	f, err := ioutil.TempFile(dir, ".modvendor-check")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
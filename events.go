@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressEvent is a line of -progress-format=ndjson output.
+type progressEvent struct {
+	Event       string `json:"event"` // start, file-copied, warning, error or done
+	Time        string `json:"time"`
+	Module      string `json:"module,omitempty"`
+	Dir         string `json:"dir,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Files       int    `json:"files,omitempty"`
+	Bytes       int64  `json:"bytes,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// ndjsonReporter writes a JSON event per line for each step of the copy
+// phase, for wrapper tools and IDE integrations.
+type ndjsonReporter struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	files int
+	bytes int64
+}
+
+func newNDJSONReporter(out io.Writer, actions []*CopyAction) *ndjsonReporter {
+	r := &ndjsonReporter{enc: json.NewEncoder(out)}
+	var size int64
+	for _, action := range actions {
+		size += action.Size
+	}
+	r.emit(progressEvent{Event: "start", Files: len(actions), Bytes: size})
+	return r
+}
+
+func (r *ndjsonReporter) emit(e progressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	r.enc.Encode(e)
+}
+
+func (r *ndjsonReporter) Copying(action *CopyAction) {}
+
+func (r *ndjsonReporter) Copied(action *CopyAction, n int64) {
+	r.files++
+	r.bytes += n
+	r.emit(progressEvent{Event: "file-copied", Module: action.Module, Dir: action.Dir, Destination: action.Destination, Bytes: n})
+}
+
+func (r *ndjsonReporter) Message(msg string) {
+	event := "error"
+	if strings.HasPrefix(msg, "Warning!") {
+		event = "warning"
+	}
+	r.emit(progressEvent{Event: event, Message: msg})
+}
+
+func (r *ndjsonReporter) Done() {
+	r.emit(progressEvent{Event: "done", Files: r.files, Bytes: r.bytes})
+}
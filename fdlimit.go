@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+// Module zips are read through reopenFiles, keeping at most maxOpenZips of
+// them open at once, so runs over hundreds of zip-only modules don't run out
+// of file descriptors.
+const maxOpenZips = 32
+
+var (
+	openZipsMu sync.Mutex
+	openZips   []*reopenFile // most recently used last
+)
+
+// reopenFile is an io.ReaderAt over a file, which is opened on demand and may
+// be closed in between reads to free its file descriptor.
+type reopenFile struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+func (r *reopenFile) ReadAt(p []byte, off int64) (int, error) {
+	for _, victim := range r.touch() {
+		victim.release()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		err := withRetry(func() (err error) {
+			r.f, err = os.Open(longPath(r.path))
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return r.f.ReadAt(p, off)
+}
+
+// touch marks the file as most recently used, returning the least recently
+// used ones to release to stay within maxOpenZips.
+func (r *reopenFile) touch() []*reopenFile {
+	openZipsMu.Lock()
+	defer openZipsMu.Unlock()
+	for i, z := range openZips {
+		if z == r {
+			openZips = append(openZips[:i], openZips[i+1:]...)
+			break
+		}
+	}
+	openZips = append(openZips, r)
+	if len(openZips) <= maxOpenZips {
+		return nil
+	}
+	n := len(openZips) - maxOpenZips
+	victims := append([]*reopenFile{}, openZips[:n]...)
+	openZips = openZips[n:]
+	return victims
+}
+
+// release closes the file until the next read.
+func (r *reopenFile) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
+
+func (r *reopenFile) Close() error {
+	openZipsMu.Lock()
+	for i, z := range openZips {
+		if z == r {
+			openZips = append(openZips[:i], openZips[i+1:]...)
+			break
+		}
+	}
+	openZipsMu.Unlock()
+	r.release()
+	return nil
+}
+
+var _ io.ReaderAt = (*reopenFile)(nil)
+
+// scanJobs caps the number of concurrent module scans to what the open file
+// limit allows, as each scan keeps a directory open per walker goroutine.
+func scanJobs(jobs int) int {
+	limit, ok := openFileLimit()
+	if !ok {
+		return jobs
+	}
+	walkers := runtime.NumCPU()
+	if walkers < 4 {
+		walkers = 4
+	}
+	// Leave room for module zips, copies and the go command
+	max := (int(limit) - maxOpenZips - 64) / walkers
+	if max < 1 {
+		max = 1
+	}
+	if jobs > max {
+		return max
+	}
+	return jobs
+}
+
+// tooManyOpenFiles reports whether err is caused by hitting the open file
+// limit of the process or system.
+func tooManyOpenFiles(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	for _, e := range tooManyOpenFilesErrnos {
+		if errno == e {
+			return true
+		}
+	}
+	return false
+}
+
+// fdHint explains errors caused by the open file limit.
+func fdHint(err error) string {
+	if tooManyOpenFiles(err) {
+		return " (too many open files, raise the limit with `ulimit -n` or lower -jobs)"
+	}
+	return ""
+}
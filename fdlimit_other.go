@@ -0,0 +1,12 @@
+//go:build !windows && !linux && !darwin && !freebsd && !openbsd && !netbsd
+// +build !windows,!linux,!darwin,!freebsd,!openbsd,!netbsd
+
+package main
+
+import "syscall"
+
+var tooManyOpenFilesErrnos = []syscall.Errno{}
+
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
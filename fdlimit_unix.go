@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd
+// +build linux darwin freebsd openbsd netbsd
+
+package main
+
+import "syscall"
+
+var tooManyOpenFilesErrnos = []syscall.Errno{syscall.EMFILE, syscall.ENFILE}
+
+// openFileLimit returns the soft limit on open files, which the go runtime
+// raises to the hard limit at startup.
+func openFileLimit() (uint64, bool) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, false
+	}
+	return uint64(rlim.Cur), true
+}
@@ -0,0 +1,11 @@
+package main
+
+import "syscall"
+
+var tooManyOpenFilesErrnos = []syscall.Errno{
+	4, // ERROR_TOO_MANY_OPEN_FILES
+}
+
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
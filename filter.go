@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// filterDecision is the answer of a -filter program for one file, one JSON
+// object per line, ie. {"action":"rename","destination":"github.com/foo/bar/config.h"}
+type filterDecision struct {
+	Action      string `json:"action"` // keep, drop or rename
+	Destination string `json:"destination,omitempty"`
+}
+
+// filterPlan runs the -filter program, streaming it each planned copy as a
+// line of JSON and reading back a filterDecision line for it. Dropped files
+// of vendorDir are removed from their module's vendor list, and renamed ones
+// get their new vendor path, so the manifest matches what's copied. Those of
+// -copy-to dirs aren't in the manifest. Renames onto the destination of
+// another copy into the same dir are refused.
+func filterPlan(command string, actions []*CopyAction, vendorDir string) ([]*CopyAction, error) {
+	cmd := shellCommand(command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("filter %q: %v", command, err)
+	}
+	fail := func(err error) ([]*CopyAction, error) {
+		stdin.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("filter %q: %v", command, err)
+	}
+
+	enc := json.NewEncoder(stdin)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	kept := actions[:0]
+	for _, action := range actions {
+		if err := enc.Encode(action); err != nil {
+			return fail(err)
+		}
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return fail(err)
+			}
+			return fail(fmt.Errorf("no answer for %s", action.Destination))
+		}
+		var decision filterDecision
+		if err := json.Unmarshal(scanner.Bytes(), &decision); err != nil {
+			return fail(fmt.Errorf("invalid answer for %s: %v", action.Destination, err))
+		}
+
+		switch decision.Action {
+		case "keep":
+		case "drop":
+			if action.Dir == vendorDir {
+				delete(action.mod.VendorList, action.vendorFile)
+			}
+			continue
+		case "rename":
+			dst := path.Clean(decision.Destination)
+			if decision.Destination == "" || path.IsAbs(dst) || dst == ".." || strings.HasPrefix(dst, "../") {
+				return fail(fmt.Errorf("invalid rename of %s to %q", action.Destination, decision.Destination))
+			}
+			action.Destination = dst
+			action.Reason += ", renamed by filter"
+			if action.Dir == vendorDir {
+				action.mod.VendorPaths[action.vendorFile] = dst
+				if action.mod.Filtered == nil {
+					action.mod.Filtered = map[string]bool{}
+				}
+				action.mod.Filtered[action.vendorFile] = true
+			}
+		default:
+			return fail(fmt.Errorf("invalid action %q for %s", decision.Action, action.Destination))
+		}
+		kept = append(kept, action)
+	}
+
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("filter %q: %v", command, err)
+	}
+
+	planned := map[string]*CopyAction{}
+	for _, action := range kept {
+		key := filepath.Join(action.Dir, filepath.FromSlash(action.Destination))
+		if other, ok := planned[key]; ok {
+			return nil, fmt.Errorf("filter %q: %s and %s would both be copied to %s", command, other.Source, action.Source, key)
+		}
+		planned[key] = action
+	}
+
+	sortActions(kept)
+	return kept, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testFilter writes a -filter script answering with the answers by
+// destination, and keep for any other file.
+func testFilter(t *testing.T, answers map[string]string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test filter is a shell script")
+	}
+	script := "while read -r line; do\n\tcase \"$line\" in\n"
+	for dst, answer := range answers {
+		script += "\t*'\"destination\":\"" + dst + "\"'*) echo '" + answer + "';;\n"
+	}
+	script += "\t*) echo '{\"action\":\"keep\"}';;\n\tesac\ndone\n"
+	scriptPath := filepath.Join(t.TempDir(), "filter.sh")
+	if err := ioutil.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return "sh " + scriptPath
+}
+
+// testFilterPlan returns the planned copies of the files of github.com/a/b,
+// read from the module cache.
+func testFilterPlan(t *testing.T, files ...string) ([]*Mod, []*CopyAction, string) {
+	t.Helper()
+	modCache := t.TempDir()
+	t.Setenv("GOMODCACHE", modCache)
+	writeTree(t, filepath.Join(modCache, "github.com", "a", "b@v1.0.0"), files...)
+	modules := parseTestModulesTxt(t, "# github.com/a/b v1.0.0\ngithub.com/a/b\n")
+	modules[0].CopyPat = []string{"**/*.h"}
+	vendorModFiles(t, modules[0])
+	vendorDir := filepath.Join(t.TempDir(), "vendor")
+	actions, err := planCopy(modules, vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return modules, actions, vendorDir
+}
+
+func TestFilterPlan(t *testing.T) {
+	modules, actions, vendorDir := testFilterPlan(t, "a.h", "drop.h", "old.h")
+	filter := testFilter(t, map[string]string{
+		"github.com/a/b/drop.h": `{"action":"drop"}`,
+		"github.com/a/b/old.h":  `{"action":"rename","destination":"github.com/a/b/include/../0.h"}`,
+	})
+	actions, err := filterPlan(filter, actions, vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, action := range actions {
+		got = append(got, action.Destination)
+	}
+	if want := "github.com/a/b/0.h github.com/a/b/a.h"; strings.Join(got, " ") != want {
+		t.Fatalf("got destinations %v, want %s", got, want)
+	}
+	if !strings.HasSuffix(actions[0].Reason, ", renamed by filter") {
+		t.Errorf("got reason %q for the renamed file", actions[0].Reason)
+	}
+
+	mod := modules[0]
+	if len(mod.VendorList) != 2 || mod.VendorList[filepath.Join(mod.Dir, "drop.h")] {
+		t.Errorf("got vendor list %v, want drop.h dropped", mod.VendorList)
+	}
+	old := filepath.Join(mod.Dir, "old.h")
+	if mod.VendorPaths[old] != "github.com/a/b/0.h" || !mod.Filtered[old] || len(mod.Filtered) != 1 {
+		t.Errorf("got vendor path %s, filtered %v, want old.h renamed", mod.VendorPaths[old], mod.Filtered)
+	}
+
+	// The manifest records where renamed files come from
+	fsys, err := plannedFS(modules, vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := buildManifest(modules, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed := manifest.Modules[0].Renamed; len(renamed) != 1 || renamed["github.com/a/b/0.h"] != "old.h" {
+		t.Errorf("got renamed %v, want 0.h from old.h", renamed)
+	}
+}
+
+func TestFilterPlanErrors(t *testing.T) {
+	for _, test := range []struct {
+		name, answer, err string
+	}{
+		{"invalid action", `{"action":"move"}`, `invalid action "move"`},
+		{"invalid json", `keep`, "invalid answer for github.com/a/b/x.h"},
+		{"rename without destination", `{"action":"rename"}`, "invalid rename of github.com/a/b/x.h"},
+		{"rename outside of the dir", `{"action":"rename","destination":"github.com/../../x.h"}`, "invalid rename of github.com/a/b/x.h"},
+		{"absolute rename", `{"action":"rename","destination":"/x.h"}`, "invalid rename of github.com/a/b/x.h"},
+		{"rename onto another file", `{"action":"rename","destination":"github.com/a/b/a.h"}`, "would both be copied to"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, actions, vendorDir := testFilterPlan(t, "a.h", "x.h")
+			filter := testFilter(t, map[string]string{"github.com/a/b/x.h": test.answer})
+			if _, err := filterPlan(filter, actions, vendorDir); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	// Filters must answer for each file
+	if runtime.GOOS == "windows" {
+		t.Skip("the test filter is a shell command")
+	}
+	_, actions, vendorDir := testFilterPlan(t, "a.h", "x.h")
+	if _, err := filterPlan("read -r line; echo '{\"action\":\"keep\"}'; read -r line", actions, vendorDir); err == nil || !strings.Contains(err.Error(), "no answer for github.com/a/b/x.h") {
+		t.Errorf("got error %v, want no answer for x.h", err)
+	}
+}
+
+func TestFilterPlanCaseCollision(t *testing.T) {
+	modules, actions, vendorDir := testFilterPlan(t, "x.h", "y.h")
+	filter := testFilter(t, map[string]string{
+		"github.com/a/b/y.h": `{"action":"rename","destination":"github.com/a/b/X.h"}`,
+	})
+	actions, err := filterPlan(filter, actions, vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := map[string]bool{"github.com/a/b/X.h": true}
+	collisions := resolveCaseCollisions(modules, collisionSuffix)
+	if len(collisions) != 1 || !collisions[0].involves(renamed) {
+		t.Fatalf("got collisions %v, want X.h and x.h", collisions)
+	}
+	if got := modules[0].VendorPaths[filepath.Join(modules[0].Dir, "y.h")]; got != "github.com/a/b/X.h" {
+		t.Errorf("got vendor path %s for the renamed file, want it kept as the first path", got)
+	}
+	if got := modules[0].VendorPaths[filepath.Join(modules[0].Dir, "x.h")]; got != "github.com/a/b/x.h.1" {
+		t.Errorf("got vendor path %s, want x.h.1", got)
+	}
+	if len(actions) != 2 {
+		t.Errorf("got %d actions, want 2", len(actions))
+	}
+}
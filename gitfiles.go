@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	gitignoreBegin = "# BEGIN modvendor: un-ignore vendored assets"
+	gitignoreEnd   = "# END modvendor"
+)
+
+// gitIgnored returns which of the paths are ignored by git, according to the
+// project's .gitignore files and the global excludes.
+func gitIgnored(paths []string) (map[string]bool, error) {
+	cmd := exec.Command("git", "check-ignore", "--no-index", "--stdin")
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		err = nil // none are ignored
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git check-ignore: %v", err)
+	}
+	ignored := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			ignored[line] = true
+		}
+	}
+	return ignored, nil
+}
+
+// gitignoreFragment returns the .gitignore lines un-ignoring the extensions
+// of the copied files which git would ignore, ie. because of a global *.a or
+// *.so, or an empty string if nothing is ignored. Extensions un-ignored by
+// the current block of the .gitignore are kept while files with them are
+// still copied.
+func gitignoreFragment(actions []*CopyAction, vendorDir, gitignorePath string) (string, error) {
+	byExt := map[string]string{}
+	paths := []string{}
+	for _, action := range actions {
+		if action.Dir != vendorDir {
+			continue
+		}
+		ext := path.Ext(action.Destination)
+		if _, ok := byExt[ext]; ext == "" || ok {
+			continue
+		}
+		p := filepath.ToSlash(filepath.Join(vendorDir, filepath.FromSlash(action.Destination)))
+		byExt[ext] = p
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		return "", nil
+	}
+	ignored, err := gitIgnored(paths)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := gitignoreBlock(gitignorePath)
+	if err != nil {
+		return "", err
+	}
+	exts := []string{}
+	for ext, p := range byExt {
+		if ignored[p] || current[gitignoreLine(vendorDir, ext)] {
+			exts = append(exts, ext)
+		}
+	}
+	if len(exts) == 0 {
+		return "", nil
+	}
+	sort.Strings(exts)
+	lines := []string{gitignoreBegin}
+	for _, ext := range exts {
+		lines = append(lines, gitignoreLine(vendorDir, ext))
+	}
+	lines = append(lines, gitignoreEnd)
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func gitignoreLine(vendorDir, ext string) string {
+	return fmt.Sprintf("!/%s/**/*%s", filepath.ToSlash(vendorDir), ext)
+}
+
+// gitignoreBlock returns the lines of the modvendor block of the .gitignore.
+func gitignoreBlock(gitignorePath string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(gitignorePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	lines := map[string]bool{}
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		switch line = strings.TrimSpace(line); {
+		case line == gitignoreBegin:
+			inBlock = true
+		case line == gitignoreEnd:
+			inBlock = false
+		case inBlock:
+			lines[line] = true
+		}
+	}
+	return lines, nil
+}
+
+// updateBlock replaces the modvendor block, from the begin to the end line,
+// of a .gitignore or .gitattributes file with fragment, or appends it.
+func updateBlock(filePath, beginLine, endLine, fragment string) error {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if begin := bytes.Index(data, []byte(beginLine)); begin >= 0 {
+		i := bytes.Index(data[begin:], []byte(endLine))
+		if i < 0 {
+			return fmt.Errorf("%s: modvendor block without %q", filePath, endLine)
+		}
+		end := begin + i + len(endLine)
+		if end < len(data) && data[end] == '\n' {
+			end++
+		}
+		data = append(data[:begin:begin], append([]byte(fragment), data[end:]...)...)
+	} else if fragment != "" {
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		data = append(data, fragment...)
+	}
+	return ioutil.WriteFile(filePath, data, 0644)
+}
+
+const (
+	gitattributesBegin = "# BEGIN modvendor: vendored assets"
+	gitattributesEnd   = "# END modvendor"
+)
+
+// gitattributesFragment returns the .gitattributes lines marking the copied
+// files of each module as linguist-vendored, and the extensions of binary
+// ones as -diff, so they don't pollute language stats and diffs.
+func gitattributesFragment(actions []*CopyAction) string {
+	dirs := map[string]bool{}
+	binaryExts := map[string]bool{}
+	sampled := map[string]bool{}
+	for _, action := range actions {
+		dirs[path.Join(filepath.ToSlash(action.Dir), action.mod.ImportPath)] = true
+		ext := path.Ext(action.Destination)
+		if ext == "" || sampled[action.Dir+ext] {
+			continue
+		}
+		sampled[action.Dir+ext] = true
+		if isBinary(action) {
+			binaryExts[path.Join(filepath.ToSlash(action.Dir), "**", "*"+ext)] = true
+		}
+	}
+	if len(dirs) == 0 {
+		return ""
+	}
+
+	lines := []string{}
+	for dir := range dirs {
+		lines = append(lines, "/"+dir+"/** linguist-vendored")
+	}
+	for pattern := range binaryExts {
+		lines = append(lines, "/"+pattern+" binary -diff")
+	}
+	sort.Strings(lines)
+	return gitattributesBegin + "\n" + strings.Join(lines, "\n") + "\n" + gitattributesEnd + "\n"
+}
+
+// isBinary reports whether the planned file has a NUL byte in its first 8KB,
+// the same heuristic git uses.
+func isBinary(action *CopyAction) bool {
+	rc, _, err := openModFile(action.mod, action.vendorFile)
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+	buf := make([]byte, 8*1024)
+	n, _ := io.ReadFull(rc, buf)
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
+
+// gitAdd stages the added and modified files with git, and the removal of the
+// pruned ones.
+func gitAdd(files, pruned []string) error {
+	if len(pruned) > 0 {
+		if err := gitPathspecs(pruned, "rm", "-r", "--cached", "--quiet", "--ignore-unmatch"); err != nil {
+			return err
+		}
+	}
+	if len(files) > 0 {
+		return gitPathspecs(files, "add", "--force")
+	}
+	return nil
+}
+
+func gitPathspecs(paths []string, args ...string) error {
+	args = append(args, "--pathspec-from-file=-", "--pathspec-file-nul")
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -1,5 +1,8 @@
 module github.com/goware/modvendor
 
-require github.com/mattn/go-zglob v0.0.2-0.20191112051448-a8912a37f9e7
+require (
+	github.com/mattn/go-zglob v0.0.2-0.20191112051448-a8912a37f9e7
+	golang.org/x/text v0.3.8
+)
 
-go 1.14
+go 1.18
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// runHook runs a -pre-hook or -post-hook command through the shell, from the
+// project root, with the JSON copy plan on stdin and MODVENDOR_VENDOR_DIR set.
+func runHook(command, vendorDir string, actions []*CopyAction) error {
+	plan, err := json.Marshal(actions)
+	if err != nil {
+		return err
+	}
+
+	cmd := shellCommand(command)
+	cmd.Stdin = bytes.NewReader(plan)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "MODVENDOR_VENDOR_DIR="+vendorDir)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q: %v", command, err)
+	}
+	return nil
+}
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
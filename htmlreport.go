@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// warningRecorder passes output through to w, recording the warnings for
+// the -report.
+type warningRecorder struct {
+	w        io.Writer
+	line     []byte
+	warnings []string
+}
+
+func (r *warningRecorder) Write(p []byte) (int, error) {
+	r.line = append(r.line, p...)
+	for {
+		i := bytes.IndexByte(r.line, '\n')
+		if i < 0 {
+			break
+		}
+		if line := string(r.line[:i]); strings.HasPrefix(line, "Warning! ") {
+			r.warnings = append(r.warnings, strings.TrimPrefix(line, "Warning! "))
+		}
+		r.line = r.line[i+1:]
+	}
+	return r.w.Write(p)
+}
+
+// reportModule is a module's section of the HTML report.
+type reportModule struct {
+	Module  string
+	License string
+	Files   []*CopyAction
+	Bytes   uint64
+}
+
+var reportFuncs = template.FuncMap{
+	"bytes": func(n interface{}) string {
+		switch n := n.(type) {
+		case int64:
+			return formatBytes(uint64(n))
+		case uint64:
+			return formatBytes(n)
+		}
+		return ""
+	},
+}
+
+// writeHTMLReport writes a self-contained HTML page of the run result, ie.
+// for CI artifacts.
+func writeHTMLReport(outPath string, result *runResult) error {
+	modules := []*reportModule{}
+	byModule := map[string]*reportModule{}
+	var total uint64
+	for _, action := range result.Actions {
+		rm, ok := byModule[action.Module]
+		if !ok {
+			if action.mod.License == "" {
+				action.mod.License = detectModLicense(action.mod)
+			}
+			rm = &reportModule{Module: action.Module, License: action.mod.License}
+			byModule[action.Module] = rm
+			modules = append(modules, rm)
+		}
+		rm.Files = append(rm.Files, action)
+		rm.Bytes += uint64(action.Size)
+		total += uint64(action.Size)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Module < modules[j].Module })
+
+	tmpl, err := template.New("report").Funcs(reportFuncs).Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		*runResult
+		ReportModules []*reportModule
+		Files         int
+		Bytes         uint64
+	}{result, modules, len(result.Actions), total})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outPath, buf.Bytes(), 0644)
+}
+
+const reportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>modvendor report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; vertical-align: top; }
+td.size { text-align: right; font-variant-numeric: tabular-nums; }
+summary { cursor: pointer; font-weight: bold; }
+.warning { color: #8a6d00; }
+.failure { color: #b00020; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>modvendor report</h1>
+<p>{{.Files}} files ({{bytes .Bytes}}) from {{len .ReportModules}} modules vendored into <code>{{.VendorDir}}</code>.</p>
+{{if .Failures}}
+<h2 class="failure">{{len .Failures}} failures</h2>
+<ul>{{range .Failures}}<li class="failure">{{.}}</li>{{end}}</ul>
+{{end}}
+{{if .Warnings}}
+<h2 class="warning">{{len .Warnings}} warnings</h2>
+<ul>{{range .Warnings}}<li class="warning">{{.}}</li>{{end}}</ul>
+{{end}}
+{{if .Changelog}}
+<h2>Changes</h2>
+<pre>{{range .Changelog}}{{.}}
+{{end}}</pre>
+{{end}}
+<h2>Modules</h2>
+<table>
+<tr><th>Module</th><th>License</th><th>Files</th><th>Size</th></tr>
+{{range $i, $m := .ReportModules}}<tr><td><a href="#module-{{$i}}">{{.Module}}</a></td><td>{{or .License "unknown"}}</td><td class="size">{{len .Files}}</td><td class="size">{{bytes .Bytes}}</td></tr>
+{{end}}</table>
+{{range $i, $m := .ReportModules}}
+<details id="module-{{$i}}">
+<summary>{{.Module}} ({{len .Files}} files, {{bytes .Bytes}})</summary>
+<table>
+<tr><th>File</th><th>Size</th><th>Reason</th></tr>
+{{range .Files}}<tr><td><code>{{.Destination}}</code>{{if ne .Dir $.VendorDir}} into <code>{{.Dir}}</code>{{end}}</td><td class="size">{{bytes .Size}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+</details>
+{{end}}
+{{if .Skipped}}
+<h2>Skipped files</h2>
+<table>
+<tr><th>Module</th><th>File</th><th>Type</th></tr>
+{{range .Skipped}}<tr><td>{{.Module}}</td><td><code>{{.Path}}</code></td><td>{{.Type}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Flagged}}
+<h2>Flagged by -scan</h2>
+<table>
+<tr><th>Module</th><th>File</th><th>Output</th></tr>
+{{range .Flagged}}<tr><td>{{.Module}}</td><td><code>{{.Destination}}</code></td><td><pre>{{.Output}}</pre></td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFile lists vendor relative paths to exclude from vendoring, in
+// gitignore syntax, ie. "**/benchmarks/**" or "*.png".
+const ignoreFile = ".modvendorignore"
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules is a parsed gitignore style file.
+type ignoreRules []ignoreRule
+
+// parseIgnoreFile reads gitignore style rules from the file, returning no
+// rules if it doesn't exist.
+func parseIgnoreFile(filePath string) (ignoreRules, error) {
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseIgnoreRules(f, filePath, false)
+}
+
+// parseIgnoreRules reads gitignore style rules, or with attributes the
+// patterns of .gitattributes lines setting (or unsetting) export-ignore.
+func parseIgnoreRules(r io.Reader, name string, attributes bool) (ignoreRules, error) {
+	rules := ignoreRules{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := false
+		if attributes {
+			fields := strings.Fields(line)
+			set := false
+			for _, attr := range fields[1:] {
+				switch attr {
+				case "export-ignore":
+					set, negate = true, false
+				case "-export-ignore", "!export-ignore":
+					set, negate = true, true
+				}
+			}
+			if !set || strings.HasPrefix(fields[0], "!") {
+				continue
+			}
+			line = fields[0]
+		}
+		rule, err := parseIgnoreRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, n, err)
+		}
+		rule.negate = rule.negate || negate
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func parseIgnoreRule(line string) (ignoreRule, error) {
+	rule := ignoreRule{}
+	if strings.HasPrefix(line, "!") {
+		rule.negate, line = true, line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	// Patterns without an inner slash match at any depth, others are relative
+	// to the vendor dir
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := ""
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case strings.HasPrefix(line[i:], "**/"):
+			expr += "(?:.*/)?"
+			i += 2
+		case line[i:] == "/**":
+			expr += "/.*"
+			i += 2
+		case line[i:] == "**":
+			expr += ".*"
+			i++
+		case c == '*':
+			expr += "[^/]*"
+		case c == '?':
+			expr += "[^/]"
+		case c == '[':
+			j := strings.IndexByte(line[i:], ']')
+			if j < 0 {
+				expr += `\[`
+				continue
+			}
+			class := line[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr += "[" + class + "]"
+			i += j
+		case c == '\\' && i+1 < len(line):
+			i++
+			expr += regexp.QuoteMeta(line[i : i+1])
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return rule, err
+	}
+	rule.re = re
+	return rule, nil
+}
+
+// match reports whether the slash separated path is ignored by the rules, on
+// its own, with the last matching rule winning.
+func (rules ignoreRules) match(p string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(p) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// ignored reports whether the file at the slash separated path is ignored,
+// either itself or because one of its parent directories is. Like with git,
+// files in ignored directories can't be re-included.
+func (rules ignoreRules) ignored(p string) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	dirs := []string{}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if rules.match(dirs[i], true) {
+			return true
+		}
+	}
+	return rules.match(p, false)
+}
+
+// moduleIgnores checks files against a module's own .gitignore files, and
+// the export-ignore attributes of its .gitattributes files, in any directory.
+// Rules of deeper directories take precedence, as with git.
+type moduleIgnores struct {
+	mod   *Mod
+	rules map[string]ignoreRules // module relative dir -> rules of its .gitignore and .gitattributes
+}
+
+func newModuleIgnores(mod *Mod) *moduleIgnores {
+	return &moduleIgnores{mod: mod, rules: map[string]ignoreRules{}}
+}
+
+// dirRules returns the rules of the module relative dir, reading them on
+// first use. Unreadable files are treated as absent.
+func (m *moduleIgnores) dirRules(dir string) ignoreRules {
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+	rules := ignoreRules{}
+	for _, f := range []struct {
+		name       string
+		attributes bool
+	}{{".gitignore", false}, {".gitattributes", true}} {
+		rc, _, err := openModFile(m.mod, filepath.Join(m.mod.Dir, filepath.FromSlash(path.Join(dir, f.name))))
+		if err != nil {
+			continue
+		}
+		r, err := parseIgnoreRules(rc, path.Join(m.mod.ImportPath, dir, f.name), f.attributes)
+		rc.Close()
+		if err == nil {
+			rules = append(rules, r...)
+		}
+	}
+	m.rules[dir] = rules
+	return rules
+}
+
+// match reports whether the module relative path is ignored on its own, by
+// the rules of the directories containing it.
+func (m *moduleIgnores) match(p string, isDir bool) bool {
+	ignored := false
+	dirs := []string{}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	bases := []string{"."}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		bases = append(bases, dirs[i])
+	}
+	for _, base := range bases {
+		rel := p
+		if base != "." {
+			rel = strings.TrimPrefix(p, base+"/")
+		}
+		for _, rule := range m.dirRules(base) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.re.MatchString(rel) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// ignored reports whether the module relative file is ignored, itself or by
+// one of its parent directories.
+func (m *moduleIgnores) ignored(relPath string) bool {
+	dirs := []string{}
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if m.match(dirs[i], true) {
+			return true
+		}
+	}
+	return m.match(relPath, false)
+}
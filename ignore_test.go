@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules, err := parseIgnoreRules(strings.NewReader(`# comment
+
+*.png
+!keep.png
+/docs/
+!docs/keep.h
+**/testdata/**
+build/*.o
+\!bang.h
+lib?.h
+[ab].c
+`+"trailing.h \t\n"), ignoreFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path    string
+		ignored bool
+	}{
+		// Patterns without a slash match at any depth
+		{"x.png", true},
+		{"github.com/a/b/x.png", true},
+		{"github.com/a/b/x.png.h", false},
+		// The last matching rule wins
+		{"github.com/a/b/keep.png", false},
+		// Dir patterns are anchored to the vendor dir
+		{"docs/x.h", true},
+		{"docs/sub/x.h", true},
+		{"docs", false},
+		{"github.com/a/docs/x.h", false},
+		// Files in ignored dirs can't be re-included
+		{"docs/keep.h", true},
+		// ** matches any number of dirs
+		{"testdata/x.h", true},
+		{"github.com/a/b/testdata/sub/x.h", true},
+		{"github.com/a/b/testdatax/x.h", false},
+		// Patterns with an inner slash are anchored, * doesn't match slashes
+		{"build/x.o", true},
+		{"build/sub/x.o", false},
+		{"github.com/a/build/x.o", false},
+		// Escapes, ? and classes
+		{"!bang.h", true},
+		{"bang.h", false},
+		{"lib1.h", true},
+		{"lib12.h", false},
+		{"a.c", true},
+		{"c.c", false},
+		// Trailing spaces are trimmed
+		{"trailing.h", true},
+	} {
+		if got := rules.ignored(test.path); got != test.ignored {
+			t.Errorf("%s: got ignored %v, want %v", test.path, got, test.ignored)
+		}
+	}
+
+	// No rules ignore nothing
+	if ignoreRules(nil).ignored("x.png") {
+		t.Error("x.png is ignored without rules")
+	}
+}
+
+func TestIgnoreRulesErrors(t *testing.T) {
+	_, err := parseIgnoreRules(strings.NewReader("*.png\n[z-a].h\n"), ignoreFile, false)
+	if err == nil || !strings.HasPrefix(err.Error(), ignoreFile+":2: ") {
+		t.Errorf("got error %v, want one for line 2", err)
+	}
+}
+
+func TestModuleIgnores(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		".gitignore":      "*.o\n!keep.o\n/gen/\n",
+		".gitattributes":  "testdata/** export-ignore\n*.md export-ignore linguist-documentation\nREADME.md -export-ignore\n!x.h export-ignore\n*.c text\n",
+		"sub/.gitignore":  "!*.o\nlocal.h\n",
+		"bad/.gitignore":  "*.h\n[z-a]\n",
+		"deep/.gitignore": "/x.h\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ignores := newModuleIgnores(&Mod{ModuleInfo: vendorplan.ModuleInfo{ImportPath: "github.com/a/b", Dir: dir}})
+
+	for _, test := range []struct {
+		path    string
+		ignored bool
+	}{
+		{"x.h", false},
+		{"x.o", true},
+		{"lib/x.o", true},
+		{"keep.o", false},
+		{"gen/x.h", true},
+		{"lib/gen/x.h", false},
+		// export-ignore attributes, and their unsetting
+		{"testdata/x.h", true},
+		{"docs.md", true},
+		{"README.md", false},
+		{"x.c", false},
+		// Rules of deeper dirs take precedence, and are relative to them
+		{"sub/x.o", false},
+		{"sub/local.h", true},
+		{"local.h", false},
+		{"deep/x.h", true},
+		{"deep/sub/x.h", false},
+		// Invalid files are ignored
+		{"bad/x.h", false},
+	} {
+		if got := ignores.ignored(test.path); got != test.ignored {
+			t.Errorf("%s: got ignored %v, want %v", test.path, got, test.ignored)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// confirmPlan prints the planned copies, marked as add or overwrite (unchanged
+// files are only counted), and asks for confirmation on in.
+func confirmPlan(actions []*CopyAction, in io.Reader) bool {
+	var added, overwritten, unchanged int
+	for _, action := range actions {
+		localFile := filepath.Join(action.Dir, filepath.FromSlash(action.Destination))
+		info, err := os.Stat(longPath(localFile))
+		switch {
+		case err != nil:
+			added++
+			fmt.Fprintf(stdout, "  add        %s\n", localFile)
+		case info.Size() == action.Size && sameContents(action, localFile):
+			unchanged++
+		default:
+			overwritten++
+			fmt.Fprintf(stdout, "  overwrite  %s\n", localFile)
+		}
+	}
+	fmt.Fprintf(stdout, "%d files to add, %d to overwrite, %d unchanged. Apply? [y/N] ", added, overwritten, unchanged)
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func sameContents(action *CopyAction, localFile string) bool {
+	src, _, err := openModFile(action.mod, action.vendorFile)
+	if err != nil {
+		return false
+	}
+	defer src.Close()
+	dst, err := os.Open(longPath(localFile))
+	if err != nil {
+		return false
+	}
+	defer dst.Close()
+
+	srcSum, err := readerSHA256(src)
+	if err != nil {
+		return false
+	}
+	dstSum, err := readerSHA256(dst)
+	return err == nil && srcSum == dstSum
+}
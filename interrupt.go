@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var interrupted int32
+
+// handleInterrupts makes SIGINT and SIGTERM stop the run gracefully, after
+// the file being copied is complete. A second signal exits right away.
+func handleInterrupts() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		atomic.StoreInt32(&interrupted, 1)
+		fmt.Fprintln(stdout, "Interrupted, stopping... (interrupt again to exit right away)")
+		<-c
+		os.Exit(exitInterrupt)
+	}()
+}
+
+func isInterrupted() bool {
+	return atomic.LoadInt32(&interrupted) != 0
+}
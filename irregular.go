@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"sort"
+)
+
+// skippedFile is a matched file which isn't a regular file, and so isn't
+// vendored, as module zips can't contain them either.
+type skippedFile struct {
+	Module string `json:"module"`
+	Path   string `json:"path"` // module relative
+	Type   string `json:"type"` // ie. "symlink" or "socket"
+
+	vendorFile string
+}
+
+// fileTypeName describes the type of a non-regular file.
+func fileTypeName(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	case mode.IsDir():
+		return "directory"
+	}
+	return "irregular file"
+}
+
+// irregularFiles returns the files of the module's vendor list which aren't
+// regular files, ie. symlinks, sockets or devices. Files of module zips are
+// always regular.
+func irregularFiles(mod *Mod) ([]skippedFile, error) {
+	skipped := []skippedFile{}
+	if mod.Zip != nil {
+		return skipped, nil
+	}
+	for vendorFile := range mod.VendorList {
+		info, err := os.Lstat(longPath(vendorFile))
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().IsRegular() {
+			continue
+		}
+		relPath, _ := modRelPath(mod, vendorFile)
+		skipped = append(skipped, skippedFile{Module: mod.String(), Path: relPath, Type: fileTypeName(info.Mode()), vendorFile: vendorFile})
+	}
+	sort.Slice(skipped, func(i, j int) bool {
+		return skipped[i].Path < skipped[j].Path
+	})
+	return skipped, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// License policies, for modules whose detected license isn't in the
+// -license-allow list.
+const (
+	licenseWarn = "warn" // vendor files anyway, with a warning
+	licenseSkip = "skip" // don't vendor files from the module, with a warning
+	licenseFail = "fail" // fail the run
+)
+
+const licenseUnknown = "unknown"
+
+var spdxRe = regexp.MustCompile(`SPDX-License-Identifier:\s*([A-Za-z0-9.+\-]+)`)
+
+// licenseTitleRe matches the titles license texts start with, on a line of
+// their own, ie. "GNU GENERAL PUBLIC LICENSE\n Version 2, June 1991". The
+// GNU licenses mention each other by name, ie. the GPL-3.0 the AGPL-3.0 and
+// the MPL-2.0 all of them, so only titles near the top of the text count,
+// the first one winning.
+var licenseTitleRe = regexp.MustCompile(`(?im)^[ \t]*(?:gnu (affero |lesser |library )?general public license|(mozilla) public license|(apache) license),?\s+version (\d+(?:\.\d+)?)\b`)
+
+// licenseTitleHead is how far into the text a title may start, ie. after a
+// copyright line.
+const licenseTitleHead = 2000
+
+var licenseTitles = map[string]string{
+	"affero 3":    "AGPL-3.0",
+	"lesser 3":    "LGPL-3.0",
+	"lesser 2.1":  "LGPL-2.1",
+	"library 2":   "LGPL-2.0",
+	" 3":          "GPL-3.0",
+	" 2":          "GPL-2.0",
+	" 1":          "GPL-1.0",
+	"mozilla 2.0": "MPL-2.0",
+	"apache 2.0":  "Apache-2.0",
+}
+
+// licenseRules classify license texts without a title by key phrases, in
+// order, ie. "Licensed under the Apache License, Version 2.0" notices. All
+// phrases of a rule must be present.
+var licenseRules = []struct {
+	id      string
+	phrases []string
+}{
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"PostgreSQL", []string{"permission to use, copy, modify, and distribute this software and its documentation for any purpose, without fee"}},
+	{"Zlib", []string{"this software is provided 'as-is', without any express or implied warranty"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+}
+
+// classifyLicense returns the SPDX identifier for a license text, preferring
+// an explicit SPDX-License-Identifier tag, then the license title, or
+// licenseUnknown.
+func classifyLicense(text string) string {
+	if m := spdxRe.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	head := text
+	if len(head) > licenseTitleHead {
+		head = head[:licenseTitleHead]
+	}
+	if m := licenseTitleRe.FindStringSubmatch(head); m != nil {
+		kind := strings.ToLower(strings.TrimSpace(m[1] + m[2] + m[3]))
+		if id, ok := licenseTitles[kind+" "+m[4]]; ok {
+			return id
+		}
+	}
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	for _, rule := range licenseRules {
+		matched := true
+		for _, phrase := range rule.phrases {
+			if !strings.Contains(text, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule.id
+		}
+	}
+	return licenseUnknown
+}
+
+func isLicenseFile(name string) bool {
+	name = strings.ToUpper(name)
+	return strings.HasPrefix(name, "LICENSE") || strings.HasPrefix(name, "LICENCE") || strings.HasPrefix(name, "COPYING")
+}
+
+// detectModLicense classifies the license files in the root of a module,
+// ie. LICENSE, LICENSE.md, COPYING. Multiple licenses are joined by " AND ".
+func detectModLicense(mod *Mod) string {
+	texts := []string{}
+	if mod.Zip != nil {
+		if err := mod.Zip.open(); err != nil {
+			return licenseUnknown
+		}
+		for relPath := range mod.Zip.files {
+			if strings.Contains(relPath, "/") || !isLicenseFile(relPath) {
+				continue
+			}
+			rc, _, err := mod.Zip.Open(relPath)
+			if err != nil {
+				continue
+			}
+			data, err := ioutil.ReadAll(io.LimitReader(rc, 64*1024))
+			rc.Close()
+			if err == nil {
+				texts = append(texts, string(data))
+			}
+		}
+	} else {
+		entries, err := ioutil.ReadDir(mod.Dir)
+		if err != nil {
+			return licenseUnknown
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isLicenseFile(entry.Name()) {
+				continue
+			}
+			text, err := readHead(filepath.Join(mod.Dir, entry.Name()), 64*1024)
+			if err == nil {
+				texts = append(texts, text)
+			}
+		}
+	}
+
+	ids := map[string]bool{}
+	for _, text := range texts {
+		if id := classifyLicense(text); id != licenseUnknown {
+			ids[id] = true
+		}
+	}
+	if len(ids) == 0 {
+		return licenseUnknown
+	}
+
+	licenses := []string{}
+	for id := range ids {
+		licenses = append(licenses, id)
+	}
+	sort.Strings(licenses)
+	return strings.Join(licenses, " AND ")
+}
+
+// licenseAllowed reports whether all licenses of an " AND " joined license
+// expression are in the allow list.
+func licenseAllowed(license string, allow []string) bool {
+	for _, id := range strings.Split(license, " AND ") {
+		allowed := false
+		for _, a := range allow {
+			if strings.EqualFold(strings.TrimSpace(a), id) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func readHead(path string, n int64) (string, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, n))
+	return string(data), err
+}
+
+// classifyFileLicenses classifies the license of each planned file from the
+// SPDX tag or license header in its first 8KB, for -file-licenses. Files
+// without a recognizable license are left out.
+func classifyFileLicenses(actions []*CopyAction) map[string]string {
+	licenses := map[string]string{}
+	for _, action := range actions {
+		if _, ok := licenses[action.Destination]; ok {
+			continue
+		}
+		rc, _, err := openModFile(action.mod, action.vendorFile)
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(rc, 8*1024))
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		if id := classifyLicense(string(data)); id != licenseUnknown {
+			licenses[action.Destination] = id
+		}
+	}
+	return licenses
+}
+
+// licenseDiffers reports whether a file's license isn't one of the licenses
+// of its module. Modules with an unknown license are never reported.
+func licenseDiffers(fileLicense, modLicense string) bool {
+	if modLicense == licenseUnknown {
+		return false
+	}
+	for _, id := range strings.Split(modLicense, " AND ") {
+		if strings.EqualFold(normalizeSPDX(id), normalizeSPDX(fileLicense)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeSPDX replaces the deprecated SPDX identifiers of the GNU licenses,
+// as classifyLicense returns them, by their current ones, ie. GPL-2.0 by
+// GPL-2.0-only and GPL-2.0+ by GPL-2.0-or-later.
+func normalizeSPDX(id string) string {
+	base := strings.TrimSuffix(id, "+")
+	switch strings.ToUpper(base) {
+	case "GPL-1.0", "GPL-2.0", "GPL-3.0", "LGPL-2.0", "LGPL-2.1", "LGPL-3.0", "AGPL-1.0", "AGPL-3.0":
+		if base != id {
+			return base + "-or-later"
+		}
+		return base + "-only"
+	}
+	return id
+}
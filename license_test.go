@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+func TestClassifyLicenseTexts(t *testing.T) {
+	// The texts in testdata/licenses are those of /usr/share/common-licenses
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"GPL-1", "GPL-1.0"},
+		{"GPL-2", "GPL-2.0"},
+		{"GPL-3", "GPL-3.0"},
+		{"LGPL-2", "LGPL-2.0"},
+		{"LGPL-2.1", "LGPL-2.1"},
+		{"LGPL-3", "LGPL-3.0"},
+		{"Apache-2.0", "Apache-2.0"},
+		{"MPL-2.0", "MPL-2.0"},
+		{"BSD", "BSD-3-Clause"},
+	}
+	for _, tt := range tests {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "licenses", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := classifyLicense(string(data)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyLicense(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"spdx tag", "// SPDX-License-Identifier: MIT\n", "MIT"},
+		{"agpl title", "                    GNU AFFERO GENERAL PUBLIC LICENSE\n                       Version 3, 19 November 2007\n", "AGPL-3.0"},
+		{"copyright before title", "Copyright (c) 2020 Foo\n\n\tGNU GENERAL PUBLIC LICENSE\n\tVersion 2, June 1991\n", "GPL-2.0"},
+		{"mit", "Permission is hereby granted, free of charge, to any person obtaining a copy", "MIT"},
+		{"gnu license mentioned", "Unlike the GNU Lesser General Public License, Version 2.1, this", licenseUnknown},
+		{"apache notice", "Licensed under the Apache License, Version 2.0 (the \"License\");", "Apache-2.0"},
+		{"unknown", "All rights reserved.", licenseUnknown},
+	}
+	for _, tt := range tests {
+		if got := classifyLicense(tt.text); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectModLicense(t *testing.T) {
+	mit := "Permission is hereby granted, free of charge, to any person obtaining a copy"
+	apache := "Licensed under the Apache License, Version 2.0 (the \"License\");"
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"license file", map[string]string{"LICENSE": mit}, "MIT"},
+		{"multiple licenses", map[string]string{"LICENSE.md": mit, "COPYING": apache, "LICENSE-MIT": mit}, "Apache-2.0 AND MIT"},
+		{"no license file", map[string]string{"README.md": mit}, licenseUnknown},
+		{"unrecognized license", map[string]string{"LICENSE": "All rights reserved."}, licenseUnknown},
+		{"license in a subdir", map[string]string{"sub/LICENSE": mit}, licenseUnknown},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for name, text := range tt.files {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(p, []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mod := &Mod{ModuleInfo: vendorplan.ModuleInfo{ImportPath: "github.com/a/b", Dir: dir}}
+		if got := detectModLicense(mod); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Modules missing from the module cache have an unknown license
+	mod := &Mod{ModuleInfo: vendorplan.ModuleInfo{ImportPath: "github.com/a/b", Dir: filepath.Join(t.TempDir(), "missing")}}
+	if got := detectModLicense(mod); got != licenseUnknown {
+		t.Errorf("missing module: got %s, want %s", got, licenseUnknown)
+	}
+}
+
+func TestLicenseAllowed(t *testing.T) {
+	tests := []struct {
+		license string
+		allow   string
+		want    bool
+	}{
+		{"MIT", "MIT,BSD-3-Clause", true},
+		{"mit", "MIT", true},
+		{"MIT", " BSD-3-Clause , MIT ", true},
+		{"GPL-3.0", "MIT,BSD-3-Clause", false},
+		{"Apache-2.0 AND MIT", "MIT,Apache-2.0", true},
+		{"Apache-2.0 AND GPL-3.0", "MIT,Apache-2.0", false},
+		{licenseUnknown, "MIT", false},
+		{licenseUnknown, "MIT,unknown", true},
+	}
+	for _, tt := range tests {
+		if got := licenseAllowed(tt.license, strings.Split(tt.allow, ",")); got != tt.want {
+			t.Errorf("%s with -license-allow=%s: got %v, want %v", tt.license, tt.allow, got, tt.want)
+		}
+	}
+}
+
+func TestLicenseDiffers(t *testing.T) {
+	tests := []struct {
+		file, mod string
+		want      bool
+	}{
+		{"MIT", "MIT", false},
+		{"mit", "Apache-2.0 AND MIT", false},
+		{"BSD-3-Clause", "MIT", true},
+		{"GPL-2.0-only", "GPL-2.0", false},
+		{"GPL-2.0", "GPL-2.0-only", false},
+		{"GPL-2.0+", "GPL-2.0-or-later", false},
+		{"LGPL-2.1-only", "MIT AND LGPL-2.1", false},
+		{"GPL-2.0-or-later", "GPL-2.0", true},
+		{"GPL-3.0-only", "GPL-2.0", true},
+		{"AGPL-3.0-only", "GPL-3.0", true},
+		{"GPL-3.0", licenseUnknown, false},
+	}
+	for _, tt := range tests {
+		if got := licenseDiffers(tt.file, tt.mod); got != tt.want {
+			t.Errorf("file %s in a %s module: got differs %v, want %v", tt.file, tt.mod, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// longPath returns path as is, extended-length paths are only needed on windows.
+func longPath(path string) string {
+	return path
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// longPath returns the extended-length form of path, ie. `\\?\C:\...`, so
+// that paths longer than MAX_PATH (260 chars) can be stat'ed, created and
+// copied. Go only does this itself for absolute paths, and we use relative
+// ./vendor/ paths.
+func longPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// UNC path, ie. \\server\share\dir
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -1,148 +1,1048 @@
 package main
 
 import (
-	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
+	"io/fs"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
-	"unicode"
+	"sync"
+	"time"
 
-	zglob "github.com/mattn/go-zglob"
+	"github.com/goware/modvendor/vendorplan"
 )
 
 var (
-	flags       = flag.NewFlagSet("modvendor", flag.ExitOnError)
+	flags       = flag.NewFlagSet("modvendor", flag.ContinueOnError)
 	copyPatFlag = flags.String("copy", "", "copy files matching glob pattern to ./vendor/ (ie. modvendor -copy=\"**/*.c **/*.h **/*.proto\")")
 	verboseFlag = flags.Bool("v", false, "verbose output")
+	colorFlag   = flags.String("color", "auto", "colorize errors and warnings: auto (if stdout is a terminal and NO_COLOR isn't set), always or never")
+	versionFlag = flags.Bool("version", false, "print modvendor version and build info")
 	includeFlag = flags.String(
 		"include",
 		"",
 		`specifies additional directories to copy into ./vendor/ which are not specified in ./vendor/modules.txt. Multiple directories can be included by comma separation e.g. -include:github.com/a/b/dir1,github.com/a/b/dir1/dir2`)
+	keepGoingFlag    = flags.Bool("keep-going", false, "continue past failures, reporting them all at the end of the run")
+	backupFlag       = flags.String("backup", "", "preserve the previous version of any file overwritten in ./vendor/ under the given directory")
+	cpuProfileFlag   = flags.String("cpuprofile", "", "write cpu profile to file")
+	memProfileFlag   = flags.String("memprofile", "", "write memory profile to file")
+	traceFlag        = flags.String("trace", "", "write execution trace to file")
+	xattrsFlag       = flags.Bool("xattrs", false, "preserve extended attributes, including POSIX ACLs and SELinux contexts, of copied files (linux only)")
+	maxMatchesFlag   = flags.Int("max-matches-per-pattern", 0, "fail if a pattern matches more files than this in any one module, 0 for no limit")
+	skipMissingFlag  = flags.Bool("skip-missing", false, "warn about modules missing from the module cache and skip them, instead of failing, ie. with trimmed CI caches")
+	explicitOnlyFlag = flags.Bool("explicit-only", false, "only vendor files from modules marked explicit in ./vendor/modules.txt, ie. direct dependencies")
+	jobsFlag         = flags.Int("jobs", runtime.NumCPU(), "number of modules to scan concurrently")
+	collisionFlag    = flags.String("case-collision", collisionWarn, "how to handle vendor paths differing only by case: warn, suffix, rename or fail")
+	cacheDirFlag     = flags.String("cache", "", "directory to cache module glob results and -run-cache stamps in, ie. ~/.cache/modvendor, off if empty")
+	runCacheFlag     = flags.Bool("run-cache", false, "skip the run if go.mod, modules.txt, the patterns and flags are unchanged since the last successful one, and the files it vendored are still there")
+	remoteCacheFlag  = flags.String("remote-cache", "", "restore the vendored files from a bundle in s3://bucket/prefix, gs://bucket/prefix or a shared dir if one exists for the same inputs as -run-cache, otherwise upload one after the run")
+	manifestFlag     = flags.String("manifest", "", "write a manifest of vendored files to the given path, and print a changelog against the previous manifest (ie. -manifest=modvendor.json)")
+
+	gitignoreFlag           = flags.String("gitignore", "", "un-ignore the extensions of copied files which git would ignore (ie. *.a or *.so): update the .gitignore, or print the fragment")
+	gitAddFlag              = flags.Bool("git-add", false, "after a successful run, stage the copied and pruned files (and the manifest) with git add")
+	gitattributesFlag       = flags.Bool("gitattributes", false, "mark copied files as linguist-vendored, and binary ones as -diff, in the .gitattributes")
+	pruneFlag               = flags.Bool("prune", false, "remove files vendored by previous runs which aren't anymore (as recorded in the -manifest), and empty directories under ./vendor/")
+	tarFlag                 = flags.String("tar", "", "after a successful run, write the vendor dir as a tar with sorted entries and normalized metadata to the given path, ie. for docker build contexts (gzipped for .gz and .tgz)")
+	checksumsFlag           = flags.Bool("checksums", false, "write the sha256 of all copied files to ./vendor/.modvendor.sha256, in sha256sum format")
+	fileLicensesFlag        = flags.Bool("file-licenses", false, "detect the license of each copied file from its SPDX tag or header, recording it in the manifest and warning about files licensed unlike their module")
+	duplicatesFlag          = flags.Bool("duplicates", false, "after copying, report files with identical contents across modules")
+	sizeReportFlag          = flags.Int("size-report", 0, "after copying, report the top N modules by vendored size and file count")
+	manifestTemplateFlag    = flags.String("manifest-template", "", "render the run result, including the manifest, with the given Go text/template file")
+	manifestTemplateOutFlag = flags.String("manifest-template-out", "", "write the -manifest-template output to the given path instead of stdout")
+	reportFlag              = flags.String("report", "", "write a browsable report of the run (modules, files, sizes, licenses, warnings) in the given format: html")
+	reportOutFlag           = flags.String("report-out", "modvendor-report.html", "path to write the -report to")
+	metricsFlag             = flags.String("metrics", "", "write run metrics (duration, files and bytes copied, failures) to the given path in Prometheus text format, ie. into the node_exporter textfile collector dir")
+
+	vendorDirFlag      = flags.String("vendor-dir", "", "vendor directory as written by go mod vendor -o, by default detected from GOFLAGS or ./vendor")
+	progressFlag       = flags.Bool("progress", false, "show a live progress dashboard while copying, per module with throughput and warnings, same as -progress-format=tui")
+	progressFormatFlag = flags.String("progress-format", "", "report copy progress as a terminal dashboard (tui) or as a stream of JSON events on stdout (ndjson)")
+	interactiveFlag    = flags.Bool("interactive", false, "show the planned copies and ask for confirmation before copying")
+	jsonFlag           = flags.Bool("json", false, "print the output of stats and outdated as JSON")
+	planFlag           = flags.Bool("plan", false, "print the planned file copies as JSON, without copying anything")
+	goListFlag         = flags.Bool("go-list", false, "derive modules and packages from go list rather than ./vendor/modules.txt, ie. for -mod=mod projects")
+
+	emptyDirsFlag       = flags.Bool("empty-dirs", false, "create directories matched by the copy patterns, or whose files were all skipped, in ./vendor/ even if empty")
+	moduleIgnoresFlag   = flags.Bool("module-ignores", false, "skip files ignored by the modules' own .gitignore files, or marked export-ignore in their .gitattributes")
+	keepFilesFlag       = flags.Bool("keep-files", false, "like -empty-dirs, and write a .keep file into the empty directories so git tracks them")
+	strictFileTypesFlag = flags.Bool("strict-file-types", false, "fail on matched files which aren't regular files, ie. symlinks, sockets or devices, instead of skipping them")
+
+	copyGroups copyGroupsFlag
+	stripFlag  = moduleFlag{}
+	overrides  = overrideFlag{}
+	sourceDirs = moduleFlag{}
+
+	allFiles     moduleSetFlag
+	assetModules moduleSetFlag
+
+	modcacheFlag      = flags.String("modcache", "", "module cache dir to read modules from, ie. a read-only snapshot mounted in CI, taking precedence over GOMODCACHE, -gopath and GOPATH")
+	gopathFlag        = flags.String("gopath", "", "GOPATH to locate the module cache in, for modvendor and the go commands it runs, ie. in containers without HOME or GOPATH")
+	fileModeFlag      = flags.String("file-mode", "", "octal mode of copied files, ie. 0644, by default the mode of the source file made owner-writable")
+	dirModeFlag       = flags.String("dir-mode", "", "octal mode of directories created for copied files, ie. 0750, by default 0755 subject to the umask")
+	ownerFlag         = flags.String("owner", "", "owner of copied files and created directories as <user>[:<group>], by name or id, or preserve to keep the owner of the module cache files, ie. when running as root")
+	releaseURLFlag    = flags.String("release-url", defaultReleaseURL, "GitHub API URL of the release to install with self-update, ie. of a mirror")
+	downgradeFlag     = flags.Bool("allow-downgrade", false, "let self-update install a release older than the running version")
+	replaceSourceFlag = flags.String("replace-source", replaceSourceReplacement, "where to copy files of replaced modules from: replacement (ie. a local replace dir, including uncommitted changes) or original (the module version before replacement)")
+	renameFlag        = flags.String("rename", "", "file mapping module files to new names when copying, one <module> <from> <to> line per file, see README")
+
+	filterFlag   = flags.String("filter", "", "shell command filtering the planned copies, answering keep, drop or rename for each file, see README")
+	preHookFlag  = flags.String("pre-hook", "", "shell command to run before copying, receiving the JSON copy plan on stdin")
+	postHookFlag = flags.String("post-hook", "", "shell command to run after copying, receiving the JSON copy plan on stdin (ie. to run clang-format over copied headers)")
+
+	scanFlag       = flags.String("scan", "", "shell command to pipe each file through before copying (ie. clamscan -), a non-zero exit flags the file")
+	scanPolicyFlag = flags.String("scan-policy", secretFail, "what to do with files flagged by -scan: warn, skip or fail")
+	secretsFlag    = flags.String("secrets", "", "scan files for obvious secrets (private keys, tokens) before copying, and warn, skip or fail")
+
+	rulesFlag         = flags.String("rules", "", "file of allow, deny and warn rules over the module, path, ext, size, license and binary-ness of each file, the first matching rule deciding, see README")
+	moduleListFlag    = flags.String("module-list", "", "file of allow <pattern> and deny <pattern> lines limiting which modules may contribute vendored files at all, see README")
+	licenseAllowFlag  = flags.String("license-allow", "", "only vendor files from modules whose detected license is in this comma separated list of SPDX identifiers (ie. MIT,BSD-3-Clause,Apache-2.0), unknown for undetected licenses")
+	licensePolicyFlag = flags.String("license-policy", licenseFail, "what to do with modules whose license isn't allowed by -license-allow: warn, skip or fail")
+
+	permissionPolicyFlag = flags.String("permission-policy", permissionWarn, "what to do with files which are setuid, setgid or world-writable: warn, skip or fail")
+	permissionAllowFlag  = flags.String("permission-allow", "", "comma separated modes to accept anyway with -permission-policy: setuid, setgid, world-writable")
+)
+
+// Exit codes, so scripts can branch on the kind of failure
+const (
+	exitUsage = 1 // invalid flags or arguments
+	exitEnv   = 2 // go.mod, vendor/modules.txt or module cache dirs missing
+	exitCopy  = 3 // failure globbing, copying or writing files
+	exitDrift = 4 // verify found files differing from the manifest, or outdated stale modules
+
+	exitInterrupt = 130 // interrupted by SIGINT or SIGTERM
 )
 
 type Mod struct {
-	ImportPath    string
-	SourcePath    string
-	Version       string
-	SourceVersion string
-	Dir           string          // full path, $GOPATH/pkg/mod/
-	Pkgs          []string        // sub-pkg import paths
-	VendorList    map[string]bool // files to vendor
+	vendorplan.ModuleInfo
+	CopyPat     []string            // -copy patterns plus the module's modvendor:copy directives
+	DestPat     map[string][]string // destination dir -> patterns, ie. ./vendor/ and -copy-to dirs
+	Renames     map[string]string   // module relative path -> renamed path, from -rename
+	Filtered    map[string]bool     // files renamed by -filter
+	License     string              // detected SPDX license identifier(s)
+	VendorList  map[string]bool     // files to vendor
+	VendorPaths map[string]string   // file to vendor -> ./vendor/ relative path
+	Zip         *modZip             // module cache zip, if Dir isn't present
+}
+
+func init() {
+	flags.Var(&copyGroups, "copy-to", "also copy files matching the patterns into another dir, as <dir>=<patterns> (ie. -copy-to=third_party=\"**/*.c **/*.h\"), can be repeated")
+	flags.Var(overrides, "override", "vendor files of a module from another version than in modules.txt, downloading it if needed, as <module>@<version> (ie. -override=github.com/foo/bar@v1.4.0-rc1), can be repeated")
+	flags.Var(sourceDirs, "source-dir", "copy files of a module from another dir, ie. a git checkout, as <module>=<dir> (ie. -source-dir=github.com/foo/bar=../bar), can be repeated")
+	flags.Var(&allFiles, "all-files", "vendor all files matching the patterns, not only those within the directories of the packages used, for all modules or as -all-files=<module> for some (ie. -all-files=github.com/foo/bar), can be repeated")
+	flags.Var(&assetModules, "asset-modules", "also vendor files from modules which provide no packages, ie. proto or header only modules, for all modules or as -asset-modules=<module> for some, can be repeated")
+	flags.Var(stripFlag, "strip", "strip leading path components of a module's files, as <module>=<count or prefix> (ie. -strip=github.com/foo/bar=parser/include), can be repeated")
+}
+
+// commands are the subcommands, running sync when none is given.
+var commands = []string{"sync", "stats", "verify", "outdated", "diff-module", "doctor", "self-update", "completion", "push", "pull"}
+
+func isCommand(command string) bool {
+	if command == "" {
+		return true
+	}
+	for _, c := range commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
 }
 
 func main() {
-	flags.Parse(os.Args[1:])
+	// Subcommands precede the flags, ie. `modvendor sync -copy="**/*.proto"`
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if !isCommand(command) {
+		fmt.Fprintf(stdout, "Whoops, unknown command %q\n", command)
+		os.Exit(exitUsage)
+	}
+
+	// diff-module, push and pull take their arguments before the flags too,
+	// ie. `modvendor diff-module github.com/foo/bar v1.2.0 v1.3.0 -copy="**/*.c"`
+	cmdArgs := []string{}
+	takesArgs := command == "diff-module" || command == "push" || command == "pull"
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") && takesArgs {
+		cmdArgs, args = append(cmdArgs, args[0]), args[1:]
+	}
+
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(exitUsage)
+	}
+
+	switch *colorFlag {
+	case "auto", "always", "never":
+		setupColor(*colorFlag)
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -color value %q\n", *colorFlag)
+		os.Exit(exitUsage)
+	}
+	var warnings *warningRecorder
+	switch *reportFlag {
+	case "":
+	case "html":
+		warnings = &warningRecorder{w: stdout}
+		stdout = warnings
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -report value %q, expected html\n", *reportFlag)
+		os.Exit(exitUsage)
+	}
+
+	if *versionFlag {
+		fmt.Fprintln(stdout, versionString())
+		return
+	}
+
+	if *gopathFlag != "" {
+		gopath, err := filepath.Abs(*gopathFlag)
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, invalid -gopath: %s\n", err.Error())
+			os.Exit(exitUsage)
+		}
+		os.Setenv("GOPATH", gopath)
+		os.Unsetenv("GOMODCACHE")
+	}
+	if *modcacheFlag != "" {
+		modcache, err := filepath.Abs(*modcacheFlag)
+		if err == nil {
+			var info os.FileInfo
+			if info, err = os.Stat(modcache); err == nil && !info.IsDir() {
+				err = fmt.Errorf("%s is not a directory", modcache)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, invalid -modcache: %s\n", err.Error())
+			os.Exit(exitUsage)
+		}
+		os.Setenv("GOMODCACHE", modcache)
+	}
+
+	// self-update doesn't need a project
+	if command == "self-update" {
+		version, updated, err := selfUpdate(*releaseURLFlag, *downgradeFlag)
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to update modvendor\n", err.Error())
+			os.Exit(exitEnv)
+		}
+		if updated {
+			fmt.Fprintf(stdout, "Updated modvendor to %s\n", version)
+		} else {
+			fmt.Fprintf(stdout, "modvendor %s is up to date\n", version)
+		}
+		return
+	}
+
+	// completion doesn't need a project, but completes its module names if
+	// run from one
+	if command == "completion" {
+		shell := ""
+		if len(flags.Args()) > 0 {
+			shell = flags.Arg(0)
+		}
+		if err := writeCompletion(stdout, shell); err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			os.Exit(exitUsage)
+		}
+		return
+	}
+
+	if err := startProfiling(); err != nil {
+		fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+		os.Exit(exitUsage)
+	}
+	defer runAtExit()
+	handleInterrupts()
 
 	// Ensure go.mod file exists and we're running from the project root,
 	// and that ./vendor/modules.txt file exists.
 	cwd, err := os.Getwd()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(stdout, err)
+		exit(exitEnv)
 	}
 	if _, err := os.Stat(filepath.Join(cwd, "go.mod")); os.IsNotExist(err) {
-		fmt.Println("Whoops, cannot find `go.mod` file")
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Whoops, cannot find `go.mod` file")
+		exit(exitEnv)
+	}
+	metrics := &runMetrics{command: command, module: goModPath(filepath.Join(cwd, "go.mod")), start: time.Now()}
+	if command == "" {
+		metrics.command = "vendor"
+	}
+	if *metricsFlag != "" {
+		atExit = append(atExit, func() {
+			if err := writeMetrics(*metricsFlag, metrics, exitCode); err != nil {
+				fmt.Fprintf(stdout, "Error! %s - unable to write metrics\n", err.Error())
+			}
+		})
 	}
-	modtxtPath := filepath.Join(cwd, "vendor", "modules.txt")
-	if _, err := os.Stat(modtxtPath); os.IsNotExist(err) {
-		fmt.Println("Whoops, cannot find vendor/modules.txt, first run `go mod vendor` and try again")
-		os.Exit(1)
+
+	// With OTEL_EXPORTER_OTLP_* set, trace the phases of the run
+	tracing, warning := newTracer()
+	if warning != "" {
+		fmt.Fprintf(stdout, "Warning! %s\n", warning)
+	}
+	runSpan := tracing.start(nil, "modvendor "+metrics.command)
+	if tracing != nil {
+		atExit = append(atExit, func() {
+			if exitCode != 0 {
+				runSpan.setError(fmt.Sprintf("exit code %d", exitCode))
+			}
+			runSpan.finish()
+			if err := tracing.export(); err != nil {
+				fmt.Fprintf(stdout, "Warning! %s - unable to export traces\n", err.Error())
+			}
+		})
+	}
+
+	vendorDir := *vendorDirFlag
+	if vendorDir == "" {
+		vendorDir = detectVendorDir()
+	}
+
+	// stats only reports on the existing vendor dir
+	if command == "stats" {
+		modules, err := parseModulesTxt(filepath.Join(vendorDir, "modules.txt"))
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s, first run `go mod vendor` and try again\n", err.Error())
+			exit(exitEnv)
+		}
+		var manifest *Manifest
+		if *manifestFlag != "" {
+			if manifest, err = readManifest(*manifestFlag); err != nil {
+				fmt.Fprintf(stdout, "Error! %s - unable to read manifest\n", err.Error())
+				exit(exitEnv)
+			}
+		}
+		stats, err := collectStats(vendorDir, modules, manifest)
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+			exit(exitEnv)
+		}
+		printStats(stdout, stats, *jsonFlag)
+		return
+	}
+
+	// verify checks the vendor dir against the manifest, ie. for hand-edits
+	// which would be lost on the next run
+	if command == "verify" {
+		if *manifestFlag == "" {
+			fmt.Fprintln(stdout, "Whoops, verify needs the -manifest to check against")
+			exit(exitUsage)
+		}
+		manifest, err := readManifest(*manifestFlag)
+		if err == nil && manifest == nil {
+			err = fmt.Errorf("%s not found", *manifestFlag)
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			exit(exitEnv)
+		}
+		modified, deleted, err := verifyManifest(vendorDir, manifest)
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+			exit(exitCopy)
+		}
+		for _, file := range modified {
+			fmt.Fprintf(stdout, "modified  %s\n", file)
+		}
+		for _, file := range deleted {
+			fmt.Fprintf(stdout, "deleted   %s\n", file)
+		}
+		if len(modified) > 0 || len(deleted) > 0 {
+			fmt.Fprintf(stdout, "Error! %d files modified, %d deleted since they were vendored\n", len(modified), len(deleted))
+			exit(exitDrift)
+		}
+		return
+	}
+
+	// outdated lists the modules whose vendored files are from another
+	// version than the project uses now, ie. after a dependency bump
+	if command == "outdated" {
+		if *manifestFlag == "" {
+			fmt.Fprintln(stdout, "Whoops, outdated needs the -manifest to check against")
+			exit(exitUsage)
+		}
+		manifest, err := readManifest(*manifestFlag)
+		if err == nil && manifest == nil {
+			err = fmt.Errorf("%s not found", *manifestFlag)
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			exit(exitEnv)
+		}
+		var modules []*Mod
+		if *goListFlag {
+			modules, err = goListModules()
+		} else {
+			modules, err = parseModulesTxt(filepath.Join(vendorDir, "modules.txt"))
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s, first run `go mod vendor` and try again\n", err.Error())
+			exit(exitEnv)
+		}
+		outdated := outdatedModules(manifest, modules, overrides)
+		printOutdated(stdout, outdated, *jsonFlag)
+		if len(outdated) > 0 {
+			if !*jsonFlag {
+				fmt.Fprintf(stdout, "Error! %d modules with vendored files from another version, run modvendor\n", len(outdated))
+			}
+			exit(exitDrift)
+		}
+		return
+	}
+
+	// push uploads the files recorded in the manifest as an OCI artifact, and
+	// pull restores them
+	if command == "push" || command == "pull" {
+		if len(cmdArgs) != 1 {
+			fmt.Fprintf(stdout, "Whoops, usage: modvendor %s oci://registry/repo:tag\n", command)
+			exit(exitUsage)
+		}
+		ref, err := ociRef(cmdArgs[0])
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			exit(exitUsage)
+		}
+		roots := bundleRoots(vendorDir, *manifestFlag)
+		if command == "pull" {
+			files, err := pullOCI(ref, roots)
+			if err != nil {
+				fmt.Fprintf(stdout, "Error! %s - unable to pull %s\n", err.Error(), ref)
+				exit(exitEnv)
+			}
+			fmt.Fprintf(stdout, "Pulled %d files from %s\n", len(files), ref)
+			return
+		}
+		if *manifestFlag == "" {
+			fmt.Fprintln(stdout, "Whoops, push needs the -manifest of the files to push")
+			exit(exitUsage)
+		}
+		manifest, err := readManifest(*manifestFlag)
+		if err == nil && manifest == nil {
+			err = fmt.Errorf("%s not found", *manifestFlag)
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			exit(exitEnv)
+		}
+		files := append(manifestFiles(vendorDir, manifest), *manifestFlag)
+		// Pulls only restore files below the roots, so nothing else is pushed
+		for _, file := range files {
+			if !bundleEntryAllowed(filepath.ToSlash(filepath.Clean(file)), roots) {
+				fmt.Fprintf(stdout, "Whoops, %s is outside of %s, it can't be pulled again\n", file, strings.Join(roots, ", "))
+				exit(exitUsage)
+			}
+		}
+		if err := pushOCI(ref, files); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to push %s\n", err.Error(), ref)
+			exit(exitEnv)
+		}
+		fmt.Fprintf(stdout, "Pushed %d files to %s\n", len(files), ref)
+		return
+	}
+
+	// doctor checks the environment, printing a checklist
+	if command == "doctor" {
+		copyPat := strings.Fields(*copyPatFlag)
+		if modCopyPat, err := parseGoModDirectives(filepath.Join(cwd, "go.mod")); err == nil {
+			for _, pats := range modCopyPat {
+				copyPat = append(copyPat, pats...)
+			}
+		}
+		checks := runDoctor(vendorDir, filepath.Join(cwd, "go.mod"), copyPat)
+		printDoctor(stdout, checks)
+		for _, c := range checks {
+			if !c.OK {
+				exit(exitEnv)
+			}
+		}
+		return
+	}
+
+	// Everything else reads from the module cache, which can't be found with
+	// neither HOME nor GOPATH set, as in scratch or distroless containers
+	if vendorplan.ModCacheDir() == "" {
+		fmt.Fprintln(stdout, "Whoops, cannot locate the module cache as neither HOME nor GOPATH is set, pass -gopath=<dir> or set GOMODCACHE")
+		exit(exitEnv)
+	}
+
+	// diff-module compares the files matching the copy patterns between two
+	// versions of a module, downloading them if needed
+	if command == "diff-module" {
+		cmdArgs = append(cmdArgs, flags.Args()...)
+		if len(cmdArgs) != 3 {
+			fmt.Fprintln(stdout, "Whoops, usage: modvendor diff-module <module> <old version> <new version> -copy=<patterns>")
+			exit(exitUsage)
+		}
+		modCopyPat, err := parseGoModDirectives(filepath.Join(cwd, "go.mod"))
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			exit(exitUsage)
+		}
+		copyPat := append(strings.Fields(*copyPatFlag), modCopyPat[cmdArgs[0]]...)
+		if len(copyPat) == 0 {
+			fmt.Fprintln(stdout, "Whoops, -copy argument is empty, nothing to diff.")
+			exit(exitUsage)
+		}
+		mods := []*Mod{}
+		for _, version := range cmdArgs[1:] {
+			mod, err := downloadModule(cmdArgs[0], version)
+			if err != nil {
+				fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+				exit(exitEnv)
+			}
+			mod.CopyPat = vendorplan.ModulePatterns(mod.ImportPath, copyPat)
+			mods = append(mods, mod)
+		}
+		diffs, err := diffModuleFiles(mods[0], mods[1])
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+			exit(exitCopy)
+		}
+		printModuleDiff(stdout, mods[0], mods[1], diffs)
+		return
+	}
+
+	// sync regenerates the vendor dir first, restoring it if anything fails
+	commitSync := func() {}
+	if command == "sync" {
+		if *goListFlag {
+			fmt.Fprintln(stdout, "Whoops, -go-list cannot be used with sync")
+			exit(exitUsage)
+		}
+		commitSync, err = syncVendor(vendorDir)
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+			exit(exitEnv)
+		}
+	}
+
+	modtxtPath := filepath.Join(vendorDir, "modules.txt")
+	if _, err := os.Stat(modtxtPath); os.IsNotExist(err) && !*goListFlag {
+		fmt.Fprintf(stdout, "Whoops, cannot find %s, first run `go mod vendor` and try again\n", modtxtPath)
+		exit(exitEnv)
 	}
 
 	// Prepare vendor copy patterns
-	copyPat := strings.Split(strings.TrimSpace(*copyPatFlag), " ")
-	if len(copyPat) == 0 {
-		fmt.Println("Whoops, -copy argument is empty, nothing to copy.")
-		os.Exit(1)
+	copyPat := strings.Fields(*copyPatFlag)
+	modCopyPat, err := parseGoModDirectives(filepath.Join(cwd, "go.mod"))
+	if err != nil {
+		fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+		exit(exitUsage)
+	}
+	vendorAbs := vendorDir
+	if !filepath.IsAbs(vendorAbs) {
+		vendorAbs = filepath.Join(cwd, vendorDir)
+	}
+	// Files modvendor copied or backed up aren't the project's own
+	skip := []string{vendorAbs, vendorAbs + ".modvendor-old"}
+	for _, dir := range append(copyGroups.dirs(), *backupFlag) {
+		if dir != "" && !filepath.IsAbs(dir) {
+			dir = filepath.Join(cwd, dir)
+		}
+		if dir != "" {
+			skip = append(skip, filepath.Clean(dir))
+		}
+	}
+	srcCopyPat, err := parseSourceDirectives(cwd, skip)
+	if err != nil {
+		fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+		exit(exitUsage)
+	}
+	for importPath, pats := range srcCopyPat {
+		modCopyPat[importPath] = append(modCopyPat[importPath], pats...)
+	}
+	renames := map[string]map[string]string{}
+	if *renameFlag != "" {
+		renames, err = vendorplan.ParseRenames(*renameFlag)
+		if err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			exit(exitUsage)
+		}
+	}
+	ignores, err := parseIgnoreFile(filepath.Join(cwd, ignoreFile))
+	if err != nil {
+		fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+		exit(exitUsage)
+	}
+	var moduleRules *moduleList
+	if *moduleListFlag != "" {
+		if moduleRules, err = parseModuleList(*moduleListFlag); err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			exit(exitUsage)
+		}
+	}
+	var policy policyRules
+	if *rulesFlag != "" {
+		if policy, err = parsePolicyRules(*rulesFlag); err != nil {
+			fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+			exit(exitUsage)
+		}
+	}
+	if len(copyPat) == 0 && len(modCopyPat) == 0 && len(copyGroups) == 0 {
+		fmt.Fprintln(stdout, "Whoops, -copy argument is empty, nothing to copy.")
+		exit(exitUsage)
 	}
 	additionalDirsToInclude := strings.Split(*includeFlag, ",")
 
-	// Parse/process modules.txt file of pkgs
-	f, _ := os.Open(modtxtPath)
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	scanner.Split(bufio.ScanLines)
+	if *xattrsFlag && !xattrsSupported {
+		fmt.Fprintln(stdout, "Whoops, -xattrs is only supported on linux")
+		exit(exitUsage)
+	}
+
+	switch *licensePolicyFlag {
+	case licenseWarn, licenseSkip, licenseFail:
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -license-policy value %q\n", *licensePolicyFlag)
+		exit(exitUsage)
+	}
+
+	if *keepFilesFlag {
+		*emptyDirsFlag = true
+	}
+
+	if *progressFlag && *progressFormatFlag == "" {
+		*progressFormatFlag = "tui"
+	}
+	switch *progressFormatFlag {
+	case "", "tui", "ndjson":
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -progress-format value %q\n", *progressFormatFlag)
+		exit(exitUsage)
+	}
+
+	switch *secretsFlag {
+	case "", secretWarn, secretSkip, secretFail:
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -secrets value %q\n", *secretsFlag)
+		exit(exitUsage)
+	}
+
+	switch *scanPolicyFlag {
+	case secretWarn, secretSkip, secretFail:
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -scan-policy value %q\n", *scanPolicyFlag)
+		exit(exitUsage)
+	}
+
+	switch *permissionPolicyFlag {
+	case permissionWarn, permissionSkip, permissionFail:
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -permission-policy value %q\n", *permissionPolicyFlag)
+		exit(exitUsage)
+	}
+	permissionAllow, err := parsePermissionAllow(*permissionAllowFlag)
+	if err != nil {
+		fmt.Fprintf(stdout, "Whoops, %s\n", err.Error())
+		exit(exitUsage)
+	}
+
+	switch *gitignoreFlag {
+	case "", "update", "print":
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -gitignore value %q\n", *gitignoreFlag)
+		exit(exitUsage)
+	}
+
+	switch *replaceSourceFlag {
+	case replaceSourceReplacement, replaceSourceOriginal:
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -replace-source value %q\n", *replaceSourceFlag)
+		exit(exitUsage)
+	}
+
+	if *runCacheFlag && *cacheDirFlag == "" {
+		fmt.Fprintln(stdout, "Whoops, -run-cache needs a -cache dir to record runs in")
+		exit(exitUsage)
+	}
+
+	if *fileModeFlag != "" {
+		mode, err := strconv.ParseUint(*fileModeFlag, 8, 32)
+		if err != nil || mode == 0 || mode > 0777 {
+			fmt.Fprintf(stdout, "Whoops, invalid -file-mode value %q, expected an octal mode like 0644\n", *fileModeFlag)
+			exit(exitUsage)
+		}
+		fileMode = os.FileMode(mode)
+	}
+	if *dirModeFlag != "" {
+		mode, err := strconv.ParseUint(*dirModeFlag, 8, 32)
+		if err != nil || mode > 0777 || mode&0700 != 0700 {
+			fmt.Fprintf(stdout, "Whoops, invalid -dir-mode value %q, expected an octal mode like 0755, which the owner has full access to\n", *dirModeFlag)
+			exit(exitUsage)
+		}
+		dirMode = os.FileMode(mode)
+	}
+	for importPath, strip := range stripFlag {
+		if n, err := strconv.Atoi(strip); err == nil && n <= 0 {
+			fmt.Fprintf(stdout, "Whoops, invalid -strip value %q for %s, expected a positive count or a path prefix\n", strip, importPath)
+			exit(exitUsage)
+		}
+	}
+	if *ownerFlag != "" {
+		if !ownersSupported {
+			fmt.Fprintln(stdout, "Whoops, -owner is not supported on this platform")
+			exit(exitUsage)
+		}
+		if owner, err = parseOwner(*ownerFlag); err != nil {
+			fmt.Fprintf(stdout, "Whoops, invalid -owner: %s\n", err.Error())
+			exit(exitUsage)
+		}
+	}
+
+	switch *collisionFlag {
+	case collisionWarn, collisionSuffix, collisionRename, collisionFail:
+	default:
+		fmt.Fprintf(stdout, "Whoops, invalid -case-collision value %q\n", *collisionFlag)
+		exit(exitUsage)
+	}
+
+	// Failures abort the run, unless -keep-going is set in which case they're
+	// collected and reported together at the end, exiting with the code of
+	// the first failure.
+	failures := []string{}
+	failureCode := 0
+	var progress progressReporter
+	abort := func(code int) { exit(code) }
+	fail := func(code int, format string, args ...interface{}) {
+		metrics.failures++
+		msg := fmt.Sprintf(format, args...)
+		if progress != nil {
+			progress.Message(msg)
+		} else {
+			fmt.Fprintln(stdout, msg)
+		}
+		if !*keepGoingFlag {
+			abort(code)
+		}
+		if failureCode == 0 {
+			failureCode = code
+		}
+		failures = append(failures, msg)
+	}
+
+	// Parse/process modules.txt file of pkgs, or with -go-list, ask the go
+	// command for the module list and packages
+	var modules []*Mod
+	if *goListFlag {
+		modules, err = goListModules()
+	} else {
+		modules, err = parseModulesTxt(modtxtPath)
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+		exit(exitEnv)
+	}
+
+	// With -run-cache, skip the run entirely if its inputs are unchanged, and
+	// with -remote-cache restore its files from a bundle for the same inputs.
+	// Local replacements and -source-dir dirs may have changed without that
+	// showing in the inputs, so aren't cached.
+	cacheable := !*planFlag && !*interactiveFlag && !*goListFlag && len(sourceDirs) == 0
+	for _, mod := range modules {
+		if !inModCache(mod) && *replaceSourceFlag != replaceSourceOriginal {
+			cacheable = false
+		}
+	}
+	if (*runCacheFlag || *remoteCacheFlag != "") && !cacheable && *verboseFlag {
+		fmt.Fprintln(stdout, "not using -run-cache or -remote-cache, the run has inputs outside of the module cache")
+	}
+	// -prune and -gitignore work on the planned files, so need a full run
+	if cacheable && (*pruneFlag || *gitignoreFlag != "") {
+		cacheable = false
+		if (*runCacheFlag || *remoteCacheFlag != "") && *verboseFlag {
+			fmt.Fprintln(stdout, "not using -run-cache or -remote-cache, -prune and -gitignore need a full run")
+		}
+	}
+	runCache := cacheable && *runCacheFlag && *cacheDirFlag != ""
+	remote := remoteCache(*remoteCacheFlag)
+	useRemote := cacheable && remote != ""
+	// finishCached ends a skipped or restored run with the steps following a
+	// successful one, for the files the cached run wrote
+	finishCached := func(files []string) {
+		commitSync()
+		if *tarFlag != "" {
+			if err := writeVendorTar(vendorDir, *tarFlag); err != nil {
+				fmt.Fprintf(stdout, "Error! %s - unable to write %s\n", err.Error(), *tarFlag)
+				exit(exitCopy)
+			}
+		}
+		if *gitAddFlag {
+			if err := gitAdd(files, nil); err != nil {
+				fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+				exit(exitCopy)
+			}
+		}
+		exit(0)
+	}
+	runStamp, runKey, runInputs := "", "", ""
+	if runCache || useRemote {
+		runInputs = runDigest(command, modCopyPat, []string{
+			filepath.Join(cwd, "go.mod"), modtxtPath, filepath.Join(cwd, ignoreFile), *renameFlag, *manifestTemplateFlag, *moduleListFlag, *rulesFlag,
+		})
+	}
+	if runCache {
+		runStamp = runCachePath(*cacheDirFlag, cwd, vendorDir)
+		runKey = runStampKey(runInputs, modtxtPath)
+		if files, ok := runCacheHit(runStamp, runKey); ok {
+			fmt.Fprintln(stdout, "Nothing changed since the last run, skipping it (-run-cache)")
+			finishCached(files)
+		}
+	}
+	if useRemote {
+		files, err := pullBundle(remote, runInputs, bundleRoots(vendorDir, *manifestFlag))
+		if err == nil {
+			fmt.Fprintf(stdout, "Restored %d files from %s\n", len(files), remote.object(runInputs))
+			if runCache {
+				writeRunCache(runStamp, runKey, files)
+			}
+			finishCached(files)
+		}
+		if *verboseFlag {
+			fmt.Fprintf(stdout, "no bundle in the remote cache: %s\n", err.Error())
+		}
+	}
+
+	// Modules are processed in import path order, as modules.txt lists them,
+	// so runs are reproducible whatever the source of the list
+	sort.SliceStable(modules, func(i, j int) bool {
+		return modules[i].ImportPath < modules[j].ImportPath
+	})
 
-	var mod *Mod
-	modules := []*Mod{}
+	for _, warning := range envWarnings(modules, filepath.Join(cwd, "go.mod"), modtxtPath) {
+		fmt.Fprintf(stdout, "Warning! %s\n", warning)
+	}
+
+	// Append directories we need to also include which may not be in vendor/modules.txt.
+	vendorplan.IncludeDirs(moduleInfos(modules), additionalDirsToInclude)
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	// Only vendor from direct dependencies with -explicit-only
+	if *explicitOnlyFlag {
+		explicit := modules[:0]
+		for _, mod := range modules {
+			if mod.Explicit {
+				explicit = append(explicit, mod)
+			}
+		}
+		modules = explicit
+	}
 
-		if line[0] == 35 {
-			s := strings.Split(line, " ")
-			if (len(s) != 6 && len(s) != 3) || s[1] == "explicit" {
+	// Modules which provide no packages, ie. listed in go 1.17+ modules.txt
+	// files for module graph pruning, have no files to vendor and may not
+	// be downloaded at all, so they're neither checked nor scanned, unless
+	// they're -asset-modules
+	withPkgs := modules[:0]
+	for _, mod := range modules {
+		if !providesFiles(mod) {
+			if *verboseFlag {
+				fmt.Fprintf(stdout, "skipping %s, it provides no packages, see -asset-modules\n", mod)
+			}
+			continue
+		}
+		withPkgs = append(withPkgs, mod)
+	}
+	modules = withPkgs
+
+	// With -module-list, only allowed modules contribute files, whatever the
+	// patterns and directives
+	if moduleRules != nil {
+		allowed := modules[:0]
+		for _, mod := range modules {
+			if !moduleRules.allowed(mod.ImportPath) {
+				if *verboseFlag {
+					fmt.Fprintf(stdout, "skipping %s, it's not allowed by %s\n", mod, *moduleListFlag)
+				}
 				continue
 			}
+			allowed = append(allowed, mod)
+		}
+		modules = allowed
+	}
 
-			mod = &Mod{
-				ImportPath: s[1],
-				Version:    s[2],
+	// Replaced modules are vendored from the replacement, ie. the working tree
+	// of a local replace dir, unless -replace-source=original
+	if *replaceSourceFlag == replaceSourceOriginal {
+		for _, mod := range modules {
+			if mod.SourcePath == "" {
+				continue
 			}
-			if s[2] == "=>" {
-				// issue https://github.com/golang/go/issues/33848 added these,
-				// see comments. I think we can get away with ignoring them.
+			if err := useOriginalSource(mod); err != nil {
+				fail(exitEnv, "Error! module %s: %s - unable to use the original module", mod, err.Error())
 				continue
 			}
-			// Handle "replace" in module file if any
-			if len(s) > 3 && s[3] == "=>" {
-				mod.SourcePath = s[4]
+			if *verboseFlag {
+				fmt.Fprintf(stdout, "vendoring %s from the original module, not its replacement\n", mod)
+			}
+		}
+	}
 
-				// Handle replaces with a relative target. For example:
-				// "replace github.com/status-im/status-go/protocol => ./protocol"
-				if strings.HasPrefix(s[4], ".") || strings.HasPrefix(s[4], "/") {
-					mod.Dir, err = filepath.Abs(s[4])
-					if err != nil {
-						fmt.Printf("invalid relative path: %v", err)
-						os.Exit(1)
-					}
-				} else {
-					mod.SourceVersion = s[5]
-					mod.Dir = pkgModPath(mod.SourcePath, mod.SourceVersion)
-				}
-			} else {
-				mod.Dir = pkgModPath(mod.ImportPath, mod.Version)
+	// Vendor from other versions of the modules given with -override
+	overridden := []string{}
+	for importPath := range overrides {
+		overridden = append(overridden, importPath)
+	}
+	sort.Strings(overridden)
+	for _, importPath := range overridden {
+		found := false
+		for _, mod := range modules {
+			if mod.ImportPath != importPath {
+				continue
+			}
+			found = true
+			if err := overrideModule(mod, overrides[importPath]); err != nil {
+				fail(exitEnv, "Error! module %s: %s - unable to override its version", mod, err.Error())
+				continue
 			}
+			fmt.Fprintf(stdout, "Warning! module %s: vendoring files of %s instead of the version in modules.txt\n", importPath, mod.Version)
+		}
+		if !found {
+			fmt.Fprintf(stdout, "Warning! -override for %s, which isn't a vendored module\n", importPath)
+		}
+	}
 
-			if _, err := os.Stat(mod.Dir); os.IsNotExist(err) {
-				fmt.Printf("Error! %q module path does not exist, check $GOPATH/pkg/mod\n", mod.Dir)
-				os.Exit(1)
+	// Copy files of the modules given with -source-dir from another dir, ie.
+	// a git checkout, Go code still comes from the module cache
+	sourceDirMods := []string{}
+	for importPath := range sourceDirs {
+		sourceDirMods = append(sourceDirMods, importPath)
+	}
+	sort.Strings(sourceDirMods)
+	for _, importPath := range sourceDirMods {
+		dir := sourceDirs[importPath]
+		found := false
+		for _, mod := range modules {
+			if mod.ImportPath != importPath {
+				continue
 			}
+			found = true
+			if mod.Dir, err = filepath.Abs(dir); err != nil {
+				fail(exitUsage, "Error! module %s: invalid -source-dir: %v", mod, err)
+				continue
+			}
+			mod.SourcePath, mod.SourceVersion = dir, ""
+		}
+		if !found {
+			fmt.Fprintf(stdout, "Warning! -source-dir for %s, which isn't a vendored module\n", importPath)
+		}
+	}
 
-			// Build list of files to module path source to project vendor folder
-			mod.VendorList = buildModVendorList(copyPat, mod)
-			// Append directories we need to also include which may not be in vendor/modules.txt.
-			for _, dir := range additionalDirsToInclude {
-				if strings.HasPrefix(dir, mod.ImportPath) {
-					mod.Pkgs = append(mod.Pkgs, dir)
+	existing := modules[:0]
+	missing := []string{}
+	for _, mod := range modules {
+		if _, err := os.Stat(mod.Dir); os.IsNotExist(err) {
+			// Fall back to reading files straight out of the module zip
+			if mod.Zip = findModZip(mod); mod.Zip == nil {
+				if *skipMissingFlag {
+					if *verboseFlag {
+						fmt.Fprintf(stdout, "skipping %s, path %q does not exist\n", mod, mod.Dir)
+					}
+					missing = append(missing, mod.ImportPath)
+					continue
 				}
+				fail(exitEnv, "Error! module %s: path %q does not exist, check $GOPATH/pkg/mod", mod, mod.Dir)
+				continue
 			}
+			if *verboseFlag {
+				fmt.Fprintf(stdout, "reading %s from %s\n", mod, mod.Zip.Path)
+			}
+		}
+		existing = append(existing, mod)
+	}
+	modules = existing
+	if len(missing) > 0 {
+		fmt.Fprintf(stdout, "Warning! %d modules aren't in the module cache, skipping them\n", len(missing))
+	}
 
-			modules = append(modules, mod)
-
+	// -copy patterns apply to all modules, modvendor:copy and go:modvendor
+	// directives only to the module they name
+	copyPat = vendorplan.TrimVendorPrefix(copyPat, vendorDir)
+	for i := range copyGroups {
+		copyGroups[i].Patterns = vendorplan.TrimVendorPrefix(copyGroups[i].Patterns, vendorDir)
+	}
+	for _, mod := range modules {
+		mod.DestPat = map[string][]string{
+			vendorDir: append(vendorplan.ModulePatterns(mod.ImportPath, copyPat), modCopyPat[mod.ImportPath]...),
+		}
+		mod.CopyPat = mod.DestPat[vendorDir]
+		mod.Renames = renames[mod.ImportPath]
+		for _, g := range copyGroups {
+			pats := vendorplan.ModulePatterns(mod.ImportPath, g.Patterns)
+			mod.DestPat[g.Dir] = append(mod.DestPat[g.Dir], pats...)
+			mod.CopyPat = append(mod.CopyPat, pats...)
+		}
+	}
+	anchored := append([]string{}, copyPat...)
+	for _, g := range copyGroups {
+		anchored = append(anchored, g.Patterns...)
+	}
+	for _, pat := range anchored {
+		if !vendorplan.IsAnchoredPattern(pat) {
 			continue
 		}
+		found := false
+		for _, mod := range modules {
+			_, ok := vendorplan.AnchorPattern(mod.ImportPath, pat)
+			found = found || ok
+		}
+		if !found {
+			fmt.Fprintf(stdout, "Warning! pattern %s starts with an import path, but no vendored module matches it\n", pat)
+		}
+	}
+	directiveMods := []string{}
+	for importPath := range modCopyPat {
+		directiveMods = append(directiveMods, importPath)
+	}
+	sort.Strings(directiveMods)
+	for _, importPath := range directiveMods {
+		found := false
+		for _, mod := range modules {
+			found = found || mod.ImportPath == importPath
+		}
+		if !found {
+			fmt.Fprintf(stdout, "Warning! copy directive for %s, which isn't a vendored module\n", importPath)
+		}
+	}
 
-		mod.Pkgs = append(mod.Pkgs, line)
+	// Build list of files to module path source to project vendor folder,
+	// scanning modules concurrently
+	jobs := scanJobs(*jobsFlag)
+	if jobs < *jobsFlag && *verboseFlag {
+		fmt.Fprintf(stdout, "scanning %d modules at a time, as allowed by the open file limit\n", jobs)
+	}
+	globSpan := runSpan.child("glob")
+	scanErrs := scanModules(modules, jobs, globSpan)
+	globSpan.finish()
+	if isInterrupted() {
+		exit(exitInterrupt)
+	}
+	scanned := modules[:0]
+	for i, mod := range modules {
+		if scanErrs[i] != nil {
+			fail(exitCopy, "Error! module %s: %v%s", mod, scanErrs[i], fdHint(scanErrs[i]))
+			continue
+		}
+		scanned = append(scanned, mod)
 	}
+	modules = scanned
 
-	// Filter out files not part of the mod.Pkgs
+	// Filter out files not part of the mod.Pkgs. Scanning already skips them,
+	// this marks the remaining ones for vendoring
 	for _, mod := range modules {
 		if len(mod.VendorList) == 0 {
 			continue
 		}
-		for vendorFile, _ := range mod.VendorList {
-			for _, subpkg := range mod.Pkgs {
-				path := filepath.Join(mod.Dir, importPathIntersect(mod.ImportPath, subpkg))
-
-				x := strings.Index(vendorFile, path)
-				if x == 0 {
-					mod.VendorList[vendorFile] = true
-				}
+		pkgs := modPkgFilter(mod)
+		for vendorFile := range mod.VendorList {
+			if relPath, ok := modRelPath(mod, vendorFile); ok && pkgs.Keep(relPath) {
+				mod.VendorList[vendorFile] = true
 			}
 		}
 		for vendorFile, toggle := range mod.VendorList {
@@ -152,101 +1052,762 @@ func main() {
 		}
 	}
 
-	// Copy mod vendor list files to ./vendor/
+	// Skip matched files which aren't regular files, or with
+	// -strict-file-types fail on them
+	skipped := []skippedFile{}
 	for _, mod := range modules {
-		for vendorFile := range mod.VendorList {
-			x := strings.Index(vendorFile, mod.Dir)
-			if x < 0 {
-				fmt.Println("Error! vendor file doesn't belong to mod, strange.")
-				os.Exit(1)
+		files, err := irregularFiles(mod)
+		if err != nil {
+			fail(exitCopy, "Error! module %s: %v", mod, err)
+			continue
+		}
+		for _, f := range files {
+			if *strictFileTypesFlag {
+				fail(exitCopy, "Error! module %s: %s is a %s, not a regular file", mod, f.Path, f.Type)
+			} else {
+				fmt.Fprintf(stdout, "Warning! module %s: skipping %s, it's a %s\n", mod, f.Path, f.Type)
 			}
+			delete(mod.VendorList, f.vendorFile)
+		}
+		skipped = append(skipped, files...)
+	}
 
-			localPath := fmt.Sprintf("%s%s", mod.ImportPath, vendorFile[len(mod.Dir):])
-			localFile := fmt.Sprintf("./vendor/%s", localPath)
+	// Keep files with dangerous modes, ie. setuid, out of the vendor dir.
+	// Other file types were skipped above already.
+	for _, mod := range modules {
+		for _, vendorFile := range sortedFiles(mod.VendorList) {
+			info, err := statModFile(mod, vendorFile)
+			if err != nil {
+				continue // reported when copying
+			}
+			issues := permissionIssues(info.Mode(), permissionAllow)
+			if len(issues) == 0 {
+				continue
+			}
+			relPath, _ := modRelPath(mod, vendorFile)
+			switch *permissionPolicyFlag {
+			case permissionFail:
+				fail(exitCopy, "Error! module %s: %s is %s, pass -permission-allow to vendor it anyway", mod, relPath, strings.Join(issues, " and "))
+				delete(mod.VendorList, vendorFile)
+			case permissionSkip:
+				fmt.Fprintf(stdout, "Warning! module %s: skipping %s, it's %s\n", mod, relPath, strings.Join(issues, " and "))
+				delete(mod.VendorList, vendorFile)
+			default:
+				fmt.Fprintf(stdout, "Warning! module %s: %s is %s\n", mod, relPath, strings.Join(issues, " and "))
+			}
+		}
+	}
 
-			if *verboseFlag {
-				fmt.Printf("vendoring %s\n", localPath)
+	// Exclude the files ignored by .modvendorignore, by their vendor paths
+	for _, mod := range modules {
+		for _, vendorFile := range sortedFiles(mod.VendorList) {
+			if localPath, ok := vendorPath(mod, vendorFile); ok && ignores.ignored(localPath) {
+				if *verboseFlag {
+					fmt.Fprintf(stdout, "ignoring %s\n", localPath)
+				}
+				delete(mod.VendorList, vendorFile)
 			}
+		}
+	}
 
-			os.MkdirAll(filepath.Dir(localFile), os.ModePerm)
-			if _, err := copyFile(vendorFile, localFile); err != nil {
-				fmt.Printf("Error! %s - unable to copy file %s\n", err.Error(), vendorFile)
-				os.Exit(1)
+	// With -module-ignores, exclude the files the modules' own .gitignore and
+	// .gitattributes export-ignore rules exclude from distribution
+	if *moduleIgnoresFlag {
+		for _, mod := range modules {
+			ignores := newModuleIgnores(mod)
+			for _, vendorFile := range sortedFiles(mod.VendorList) {
+				if relPath, ok := modRelPath(mod, vendorFile); ok && ignores.ignored(relPath) {
+					if *verboseFlag {
+						fmt.Fprintf(stdout, "ignoring %s, as ignored by module %s\n", relPath, mod)
+					}
+					delete(mod.VendorList, vendorFile)
+				}
 			}
 		}
 	}
-}
 
-func buildModVendorList(copyPat []string, mod *Mod) map[string]bool {
-	vendorList := map[string]bool{}
+	// Directories to create with -empty-dirs, including those whose files
+	// all get skipped below
+	emptyDirs := map[string]bool{}
+	if *emptyDirsFlag {
+		if emptyDirs, err = keptDirs(modules); err != nil {
+			fail(exitCopy, "Error! %s - unable to list directories", err.Error())
+		}
+	}
+
+	// Check the licenses of modules with files to vendor against the policy
+	if *licenseAllowFlag != "" {
+		allow := strings.Split(*licenseAllowFlag, ",")
+		for _, mod := range modules {
+			if len(mod.VendorList) == 0 {
+				continue
+			}
+			mod.License = detectModLicense(mod)
+			if licenseAllowed(mod.License, allow) {
+				continue
+			}
+			switch *licensePolicyFlag {
+			case licenseFail:
+				fail(exitCopy, "Error! module %s: license %s is not allowed", mod, mod.License)
+				mod.VendorList = map[string]bool{}
+			case licenseSkip:
+				fmt.Fprintf(stdout, "Warning! module %s: license %s is not allowed, skipping %d files\n", mod, mod.License, len(mod.VendorList))
+				mod.VendorList = map[string]bool{}
+			default:
+				fmt.Fprintf(stdout, "Warning! module %s: license %s is not allowed\n", mod, mod.License)
+			}
+		}
+	}
 
-	for _, pat := range copyPat {
-		matches, err := zglob.Glob(filepath.Join(mod.Dir, pat))
+	// Map files to their ./vendor/ paths. With -strip, several files of a
+	// module may end up at the same path.
+	mapped := map[string]string{}
+	for _, mod := range modules {
+		mod.VendorPaths = map[string]string{}
+		for _, vendorFile := range sortedFiles(mod.VendorList) {
+			localPath, ok := vendorPath(mod, vendorFile)
+			if !ok {
+				fail(exitCopy, "Error! module %s: vendor file %s doesn't belong to mod, strange.", mod, vendorFile)
+				delete(mod.VendorList, vendorFile)
+				continue
+			}
+			if other, ok := mapped[localPath]; ok {
+				fail(exitCopy, "Error! module %s: %s and %s would both be vendored to %s", mod, other, vendorFile, localPath)
+				delete(mod.VendorList, vendorFile)
+				continue
+			}
+			mapped[localPath] = vendorFile
+			mod.VendorPaths[vendorFile] = localPath
+		}
+	}
+
+	// Detect paths which would collide on case-insensitive filesystems
+	for _, collision := range resolveCaseCollisions(modules, *collisionFlag) {
+		if *collisionFlag == collisionFail {
+			fail(exitCopy, "Error! %s", collision)
+		} else {
+			fmt.Fprintf(stdout, "Warning! %s\n", collision)
+		}
+	}
+
+	planSpan := runSpan.child("plan")
+	actions, err := planCopy(modules, vendorDir)
+	if err != nil {
+		fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+		exit(exitCopy)
+	}
+	actions = planDestinations(actions, vendorDir)
+	if *filterFlag != "" {
+		actions, err = filterPlan(*filterFlag, actions, vendorDir)
 		if err != nil {
-			fmt.Println("Error! glob match failure:", err)
-			os.Exit(1)
+			fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+			exit(exitCopy)
+		}
+		// Files renamed by the filter may collide with others now, only
+		// those collisions are new
+		renamed := map[string]bool{}
+		for _, action := range actions {
+			if action.Dir == vendorDir && action.mod.Filtered[action.vendorFile] {
+				renamed[action.Destination] = true
+			}
 		}
+		for _, collision := range resolveCaseCollisions(modules, *collisionFlag) {
+			if !collision.involves(renamed) {
+				continue
+			}
+			if *collisionFlag == collisionFail {
+				fail(exitCopy, "Error! %s", collision)
+			} else {
+				fmt.Fprintf(stdout, "Warning! %s\n", collision)
+			}
+		}
+		for _, action := range actions {
+			if action.Dir == vendorDir {
+				action.Destination = action.mod.VendorPaths[action.vendorFile]
+			}
+		}
+		sortActions(actions)
+	}
+	// Apply the -rules, with the first rule matching a file deciding
+	if len(policy) > 0 {
+		licenses := map[*Mod]string{}
+		allowed := actions[:0]
+		for _, action := range actions {
+			mod := action.mod
+			f := &ruleFile{action: action, license: func() string {
+				if _, ok := licenses[mod]; !ok {
+					licenses[mod] = mod.License
+					if licenses[mod] == "" {
+						licenses[mod] = detectModLicense(mod)
+					}
+				}
+				return licenses[mod]
+			}}
+			rule := policy.eval(f)
+			switch {
+			case rule == nil || rule.Action == ruleAllow:
+			case rule.Action == ruleDeny:
+				fmt.Fprintf(stdout, "Warning! module %s: skipping %s, denied by %s\n", mod, action.Destination, rule.Source)
+				if action.Dir == vendorDir {
+					delete(mod.VendorList, action.vendorFile)
+				}
+				continue
+			default:
+				fmt.Fprintf(stdout, "Warning! module %s: %s matches %s\n", mod, action.Destination, rule.Source)
+			}
+			allowed = append(allowed, action)
+		}
+		actions = allowed
+	}
+	if *secretsFlag != "" {
+		scanned := actions[:0]
+		for _, action := range actions {
+			kind, err := scanSecrets(action)
+			if err != nil {
+				fail(exitCopy, "Error! %s", fileError(action.mod, action.vendorFile, "scan", err))
+				continue
+			}
+			if kind == "" {
+				scanned = append(scanned, action)
+				continue
+			}
+			switch *secretsFlag {
+			case secretFail:
+				fail(exitCopy, "Error! module %s: %s looks like it contains a secret (%s)", action.mod, action.Destination, kind)
+				continue
+			case secretSkip:
+				fmt.Fprintf(stdout, "Warning! module %s: %s looks like it contains a secret (%s), skipping it\n", action.mod, action.Destination, kind)
+				if action.Dir == vendorDir {
+					delete(action.mod.VendorList, action.vendorFile)
+				}
+				continue
+			default:
+				fmt.Fprintf(stdout, "Warning! module %s: %s looks like it contains a secret (%s)\n", action.mod, action.Destination, kind)
+			}
+			scanned = append(scanned, action)
+		}
+		actions = scanned
+	}
+	// Pipe each file through the -scan command, with the same policies as
+	// for -secrets
+	flagged := []scanResult{}
+	if *scanFlag != "" {
+		scanned := actions[:0]
+		for _, action := range actions {
+			isFlagged, output, err := scanFile(*scanFlag, action)
+			if err != nil {
+				fail(exitCopy, "Error! %s", err)
+				continue
+			}
+			if !isFlagged {
+				scanned = append(scanned, action)
+				continue
+			}
+			flagged = append(flagged, scanResult{Module: action.Module, Destination: action.Destination, Output: output})
+			switch *scanPolicyFlag {
+			case secretFail:
+				fail(exitCopy, "Error! module %s: %s was flagged by -scan: %s", action.mod, action.Destination, output)
+				continue
+			case secretSkip:
+				fmt.Fprintf(stdout, "Warning! module %s: %s was flagged by -scan, skipping it: %s\n", action.mod, action.Destination, output)
+				if action.Dir == vendorDir {
+					delete(action.mod.VendorList, action.vendorFile)
+				}
+				continue
+			default:
+				fmt.Fprintf(stdout, "Warning! module %s: %s was flagged by -scan: %s\n", action.mod, action.Destination, output)
+			}
+			scanned = append(scanned, action)
+		}
+		printScanSummary(stdout, len(actions), flagged)
+		actions = scanned
+	}
+	if *planFlag {
+		data, _ := json.MarshalIndent(actions, "", "  ")
+		fmt.Fprintln(stdout, string(data))
+		return
+	}
+	if *interactiveFlag && !confirmPlan(actions, os.Stdin) {
+		fmt.Fprintln(stdout, "Nothing copied")
+		return
+	}
+	if err := checkDiskSpace(actions); err != nil {
+		fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+		exit(exitCopy)
+	}
 
-		for _, m := range matches {
-			vendorList[m] = false
+	// Copy mod vendor list files to ./vendor/. Overwritten files are staged in
+	// the backup dir (or a temp dir) so ./vendor/ can be restored on failure.
+	backupDir := *backupFlag
+	if backupDir == "" {
+		backupDir, err = ioutil.TempDir("", "modvendor")
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to create staging dir\n", err.Error())
+			exit(exitCopy)
 		}
 	}
+	cleanup := func() {
+		if *backupFlag == "" {
+			os.RemoveAll(backupDir)
+		}
+	}
+	rollback := newRollback(backupDir)
+	abort = func(code int) {
+		if err := rollback.Rollback(); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to restore %s to its previous state\n", err.Error(), vendorDir)
+		} else {
+			fmt.Fprintf(stdout, "Restored %s to its previous state\n", vendorDir)
+		}
+		cleanup()
+		exit(code)
+	}
 
-	return vendorList
-}
+	if *preHookFlag != "" {
+		if err := runHook(*preHookFlag, vendorDir, actions); err != nil {
+			fail(exitCopy, "Error! %s", err)
+		}
+	}
 
-func importPathIntersect(basePath, pkgPath string) string {
-	if strings.Index(pkgPath, basePath) != 0 {
-		return ""
+	switch *progressFormatFlag {
+	case "tui":
+		progress = newDashboard(stdout, actions)
+	case "ndjson":
+		progress = newNDJSONReporter(os.Stdout, actions)
+	}
+	planSpan.setAttr("files", len(actions))
+	planSpan.finish()
+	copySpan := runSpan.child("copy")
+	metrics.files, metrics.bytes = applyCopy(actions, vendorDir, rollback, progress, fail)
+	copySpan.setAttr("files", metrics.files)
+	copySpan.setAttr("bytes", metrics.bytes)
+	copySpan.finish()
+	progress = nil
+
+	// When interrupted, the files copied so far are kept (and recorded in the
+	// manifest), except for sync which restores the previous vendor dir.
+	if isInterrupted() && command == "sync" {
+		cleanup()
+		exit(exitInterrupt)
+	}
+
+	keepDirs := map[string]bool{}
+	keepFiles := []string{}
+	if *emptyDirsFlag && !isInterrupted() {
+		for _, dir := range sortedFiles(emptyDirs) {
+			localDir := filepath.Join(vendorDir, filepath.FromSlash(dir))
+			keepDirs[localDir] = true
+			if _, err := os.Stat(longPath(localDir)); os.IsNotExist(err) {
+				if err := mkdirAll(localDir); err != nil {
+					fail(exitCopy, "Error! %s - unable to create %s", err.Error(), localDir)
+					continue
+				}
+				if *verboseFlag {
+					fmt.Fprintf(stdout, "creating empty directory %s\n", dir)
+				}
+			}
+			// Drop a .keep file into directories left empty, so git tracks them
+			if !*keepFilesFlag {
+				continue
+			}
+			entries, err := ioutil.ReadDir(longPath(localDir))
+			if err != nil {
+				fail(exitCopy, "Error! %s - unable to read %s", err.Error(), localDir)
+				continue
+			}
+			if len(entries) > 0 && !(len(entries) == 1 && entries[0].Name() == keepFile) {
+				continue
+			}
+			localFile := filepath.Join(localDir, keepFile)
+			if err := ioutil.WriteFile(longPath(localFile), nil, 0644); err != nil {
+				fail(exitCopy, "Error! %s - unable to write %s", err.Error(), localFile)
+				continue
+			}
+			keepFiles = append(keepFiles, localFile)
+		}
+	}
+
+	if *postHookFlag != "" && !isInterrupted() {
+		if err := runHook(*postHookFlag, vendorDir, actions); err != nil {
+			fail(exitCopy, "Error! %s", err)
+		}
+	}
+
+	// Classify the license of each copied file, flagging those under another
+	// license than their module
+	var fileLicenses map[string]string
+	if *fileLicensesFlag {
+		fileLicenses = classifyFileLicenses(actions)
+		for _, action := range actions {
+			license, ok := fileLicenses[action.Destination]
+			if !ok || action.Dir != vendorDir {
+				continue
+			}
+			if action.mod.License == "" {
+				action.mod.License = detectModLicense(action.mod)
+			}
+			if licenseDiffers(license, action.mod.License) {
+				fmt.Fprintf(stdout, "Warning! module %s: %s is licensed %s, unlike its module (%s)\n", action.mod, action.Destination, license, action.mod.License)
+			}
+		}
+	}
+
+	// Write manifest and print changelog of vendored files since the last run
+	var prevManifest, manifest *Manifest
+	changelog := []string{}
+	if *manifestFlag != "" {
+		prevManifest, err = readManifest(*manifestFlag)
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to read manifest\n", err.Error())
+			exit(exitCopy)
+		}
+	}
+	if *manifestFlag != "" || *manifestTemplateFlag != "" || *reportFlag != "" || *duplicatesFlag || *checksumsFlag {
+		var fsys fs.FS
+		if fsys, err = plannedFS(modules, vendorDir); err == nil {
+			manifest, err = buildManifest(modules, fsys, fileLicenses)
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to build manifest\n", err.Error())
+			exit(exitCopy)
+		}
+		// Modules skipped by -skip-missing keep the files vendored before
+		if prevManifest != nil && len(missing) > 0 {
+			for _, importPath := range missing {
+				if mm := prevManifest.module(importPath); mm != nil {
+					manifest.Modules = append(manifest.Modules, mm)
+				}
+			}
+			sort.Slice(manifest.Modules, func(i, j int) bool {
+				return manifest.Modules[i].ImportPath < manifest.Modules[j].ImportPath
+			})
+		}
+	}
+
+	// Remove the files vendored by previous runs which aren't anymore, and
+	// the directories left empty
+	pruned := []string{}
+	if *pruneFlag {
+		if prevManifest != nil && !isInterrupted() {
+			for _, file := range staleFiles(prevManifest, manifest) {
+				if goModVendored(modules, file) {
+					continue
+				}
+				localFile := filepath.Join(vendorDir, filepath.FromSlash(file))
+				if _, err := os.Stat(longPath(localFile)); os.IsNotExist(err) {
+					continue
+				}
+				if err := rollback.Prepare(file, localFile); err != nil {
+					fail(exitCopy, "Error! %s - unable to back up %s", err.Error(), localFile)
+					continue
+				}
+				if err := os.Remove(longPath(localFile)); err != nil {
+					fail(exitCopy, "Error! %s - unable to prune %s", err.Error(), localFile)
+					continue
+				}
+				if *verboseFlag {
+					fmt.Fprintf(stdout, "pruning %s\n", file)
+				}
+				pruned = append(pruned, localFile)
+			}
+		}
+		dirs, err := pruneEmptyDirs(vendorDir, keepDirs)
+		if err != nil {
+			fail(exitCopy, "Error! %s - unable to prune empty directories", err.Error())
+		}
+		pruned = append(pruned, dirs...)
+	}
+
+	if *manifestFlag != "" {
+		if err := writeManifest(*manifestFlag, manifest); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to write manifest\n", err.Error())
+			exit(exitCopy)
+		}
+		if prevManifest != nil {
+			changelog = manifestChangelog(prevManifest, manifest)
+			for _, line := range changelog {
+				fmt.Fprintln(stdout, line)
+			}
+			removed := removedUpstream(prevManifest, manifest, modules)
+			for _, mod := range modules {
+				if len(removed[mod.ImportPath]) == 0 {
+					continue
+				}
+				fmt.Fprintf(stdout, "module %s %s→%s: %d files removed upstream:\n", mod.ImportPath, prevManifest.module(mod.ImportPath).Version, mod.Version, len(removed[mod.ImportPath]))
+				for _, file := range removed[mod.ImportPath] {
+					fmt.Fprintf(stdout, "\t%s\n", file)
+				}
+			}
+		}
+	}
+
+	// Un-ignore the vendored files which git would ignore
+	if *gitignoreFlag != "" {
+		fragment, err := gitignoreFragment(actions, vendorDir, ".gitignore")
+		if err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to check ignored files\n", err.Error())
+			exit(exitCopy)
+		}
+		if *gitignoreFlag == "print" {
+			fmt.Fprint(stdout, fragment)
+		} else if err := updateBlock(".gitignore", gitignoreBegin, gitignoreEnd, fragment); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to update .gitignore\n", err.Error())
+			exit(exitCopy)
+		}
+	}
+
+	// Mark copied files as vendored, and binary ones as such
+	if *gitattributesFlag {
+		if err := updateBlock(".gitattributes", gitattributesBegin, gitattributesEnd, gitattributesFragment(actions)); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to update .gitattributes\n", err.Error())
+			exit(exitCopy)
+		}
+	}
+
+	if *checksumsFlag {
+		if err := writeChecksums(filepath.Join(vendorDir, checksumsFile), manifest); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to write %s\n", err.Error(), checksumsFile)
+			exit(exitCopy)
+		}
+	}
+
+	if *sizeReportFlag > 0 {
+		printSizeReport(stdout, actions, *sizeReportFlag)
+	}
+	if *duplicatesFlag {
+		printDuplicates(stdout, findDuplicates(manifest, actions))
+	}
+
+	// Render the run result in a custom format, or as a report
+	result := &runResult{
+		VendorDir: vendorDir,
+		Actions:   actions,
+		Changelog: changelog,
+		Failures:  failures,
+		Flagged:   flagged,
+		Skipped:   skipped,
+	}
+	if manifest != nil {
+		result.Modules = manifest.Modules
+	}
+	if warnings != nil {
+		result.Warnings = warnings.warnings
+	}
+	if *manifestTemplateFlag != "" {
+		if err := renderTemplate(*manifestTemplateFlag, *manifestTemplateOutFlag, result); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to render manifest template\n", err.Error())
+			exit(exitCopy)
+		}
+	}
+	if *reportFlag == "html" {
+		if err := writeHTMLReport(*reportOutFlag, result); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to write %s\n", err.Error(), *reportOutFlag)
+			exit(exitCopy)
+		}
+	}
+
+	cleanup()
+	if isInterrupted() {
+		exit(exitInterrupt)
+	}
+	commitSync()
+
+	if *tarFlag != "" && len(failures) == 0 {
+		if err := writeVendorTar(vendorDir, *tarFlag); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to write %s\n", err.Error(), *tarFlag)
+			exit(exitCopy)
+		}
+	}
+
+	// Stage the changes, (only) after a successful run
+	if *gitAddFlag && len(failures) == 0 {
+		files := append([]string{}, keepFiles...)
+		for _, action := range actions {
+			if action.mod.VendorList[action.vendorFile] {
+				files = append(files, filepath.Join(action.Dir, filepath.FromSlash(action.Destination)))
+			}
+		}
+		for _, f := range []struct {
+			path string
+			set  bool
+		}{
+			{*manifestFlag, *manifestFlag != ""},
+			{filepath.Join(vendorDir, checksumsFile), *checksumsFlag},
+			{".gitignore", *gitignoreFlag == "update"},
+			{".gitattributes", *gitattributesFlag},
+		} {
+			if _, err := os.Stat(f.path); f.set && err == nil {
+				files = append(files, f.path)
+			}
+		}
+		if command == "sync" {
+			files = append(files, vendorDir)
+		}
+		if err := gitAdd(files, pruned); err != nil {
+			fmt.Fprintf(stdout, "Error! %s\n", err.Error())
+			exit(exitCopy)
+		}
+	}
+
+	if (runCache || useRemote) && len(failures) == 0 {
+		files := append([]string{}, keepFiles...)
+		for _, action := range actions {
+			if action.mod.VendorList[action.vendorFile] {
+				files = append(files, filepath.Join(action.Dir, filepath.FromSlash(action.Destination)))
+			}
+		}
+		if *manifestFlag != "" {
+			files = append(files, *manifestFlag)
+		}
+		if *checksumsFlag {
+			files = append(files, filepath.Join(vendorDir, checksumsFile))
+		}
+		if runCache {
+			writeRunCache(runStamp, runKey, files)
+		}
+		// A run without a bundle is still a successful run
+		if useRemote {
+			if err := pushBundle(remote, runInputs, files); err != nil {
+				fmt.Fprintf(stdout, "Warning! %s - unable to upload the bundle to %s\n", err.Error(), remote)
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		fmt.Fprintf(stdout, "\n%d failures:\n", len(failures))
+		for _, msg := range failures {
+			fmt.Fprintf(stdout, "  %s\n", msg)
+		}
+		exit(failureCode)
 	}
-	return pkgPath[len(basePath):]
 }
 
-func normString(str string) (normStr string) {
-	for _, char := range str {
-		if unicode.IsUpper(char) {
-			normStr += "!" + string(unicode.ToLower(char))
-		} else {
-			normStr += string(char)
+// scanModules builds the vendor list of each module, running up to jobs scans
+// concurrently. The returned errors are indexed by module.
+func scanModules(modules []*Mod, jobs int, parent *span) []error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	errs := make([]error, len(modules))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+
+	for i, mod := range modules {
+		if len(mod.CopyPat) == 0 {
+			continue
 		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, mod *Mod) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if isInterrupted() {
+				return
+			}
+			s := parent.child("glob " + mod.String())
+			defer func() {
+				s.setAttr("files", len(mod.VendorList))
+				if errs[i] != nil {
+					s.setError(errs[i].Error())
+				}
+				s.finish()
+			}()
+			// Skip walking modules without files of the pattern extensions
+			if cannotMatch(*cacheDirFlag, mod, mod.CopyPat) {
+				mod.VendorList = map[string]bool{}
+				return
+			}
+			mod.VendorList, errs[i] = buildModVendorList(mod)
+		}(i, mod)
 	}
-	return
+	wg.Wait()
+
+	return errs
 }
 
-func pkgModPath(importPath, version string) string {
-	goPath := os.Getenv("GOPATH")
-	if goPath == "" {
-		// the default GOPATH for go v1.11
-		goPath = filepath.Join(os.Getenv("HOME"), "go")
+func buildModVendorList(mod *Mod) (map[string]bool, error) {
+	var vendorList map[string]bool
+	var err error
+	if mod.Zip != nil {
+		vendorList, err = globModZipFiles(mod, mod.CopyPat, *maxMatchesFlag, modPkgFilter(mod))
+	} else {
+		vendorList, err = cachedGlobModFiles(*cacheDirFlag, mod, mod.CopyPat, *maxMatchesFlag, modPkgFilter(mod))
 	}
+	if _, ok := err.(*vendorplan.TooManyMatchesError); ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("glob: %v", err)
+	}
+	return vendorList, nil
+}
 
-	normPath := normString(importPath)
-	normVersion := normString(version)
+// fileError describes a failed operation on a module file with the module,
+// copy pattern and module relative file path involved, ie.
+// "module github.com/foo@v1.2.3: pattern **/*.h: copy include/x.h: permission denied"
+func fileError(mod *Mod, vendorFile, op string, err error) string {
+	pattern := matchingPattern(mod, vendorFile)
+
+	// The module relative path is reported instead of the full source path
+	if pathErr, ok := err.(*os.PathError); ok && pathErr.Path == vendorFile {
+		err = pathErr.Err
+	}
 
-	return filepath.Join(goPath, "pkg", "mod", fmt.Sprintf("%s@%s", normPath, normVersion))
+	relPath, _ := modRelPath(mod, vendorFile)
+	return fmt.Sprintf("module %s: pattern %s: %s %s: %v%s", mod, pattern, op, relPath, err, fdHint(err))
 }
 
-func copyFile(src, dst string) (int64, error) {
-	srcStat, err := os.Stat(src)
-	if err != nil {
-		return 0, err
+// matchingPattern returns the first of the module's copy patterns matching
+// vendorFile, or "?" if none does, ie. for -include dirs.
+func matchingPattern(mod *Mod, vendorFile string) string {
+	for _, pat := range mod.CopyPat {
+		if vendorplan.MatchPattern(mod.Dir, pat, vendorFile) {
+			return pat
+		}
 	}
+	return "?"
+}
 
-	if !srcStat.Mode().IsRegular() {
-		return 0, fmt.Errorf("%s is not a regular file", src)
+// modRelPath returns the slash separated path of vendorFile relative to the
+// module dir, or false if vendorFile is outside of it.
+func modRelPath(mod *Mod, vendorFile string) (string, bool) {
+	return vendorplan.RelPath(mod.Dir, vendorFile)
+}
+
+// vendorPath returns the slash separated ./vendor/ relative path vendorFile is
+// copied to, ie. "github.com/foo/bar/include/x.h".
+func vendorPath(mod *Mod, vendorFile string) (string, bool) {
+	relPath, ok := modRelPath(mod, vendorFile)
+	if !ok {
+		return "", false
 	}
+	return vendorplan.Destination(mod.ImportPath, relPath, stripFlag[mod.ImportPath], mod.Renames), true
+}
 
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return 0, err
+// moduleInfos returns the vendorplan modules of the modules, sharing their
+// fields.
+func moduleInfos(modules []*Mod) []*vendorplan.ModuleInfo {
+	infos := make([]*vendorplan.ModuleInfo, len(modules))
+	for i, mod := range modules {
+		infos[i] = &mod.ModuleInfo
 	}
-	defer srcFile.Close()
+	return infos
+}
 
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		return 0, err
+// sortedFiles returns the files of a vendor list in sorted order, so what's
+// reported or decided per file doesn't depend on map iteration order.
+func sortedFiles(vendorList map[string]bool) []string {
+	files := make([]string, 0, len(vendorList))
+	for vendorFile := range vendorList {
+		files = append(files, vendorFile)
 	}
-	defer dstFile.Close()
+	sort.Strings(files)
+	return files
+}
 
-	return io.Copy(dstFile, srcFile)
+// copyModFile copies a file of the module to dst, from the module dir or
+// the module zip.
+func copyModFile(mod *Mod, vendorFile, dst string) (int64, error) {
+	if mod.Zip != nil {
+		return copyModZipFile(mod, vendorFile, dst)
+	}
+	return copyFile(vendorFile, dst)
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+func TestVendorPathMajorVersions(t *testing.T) {
+	defer func(strip moduleFlag) { stripFlag = strip }(stripFlag)
+	stripFlag = moduleFlag{"github.com/pganalyze/pg_query_go/v2": "parser"}
+
+	dir := filepath.Join("mod", "github.com", "pganalyze", "pg_query_go", "v2@v2.1.0")
+	mod := &Mod{
+		ModuleInfo: vendorplan.ModuleInfo{ImportPath: "github.com/pganalyze/pg_query_go/v2", Dir: dir},
+		Renames:    map[string]string{"parser/include/config_linux.h": "parser/include/config.h"},
+	}
+	for relPath, want := range map[string]string{
+		"pg_query.h":                    "github.com/pganalyze/pg_query_go/v2/pg_query.h",
+		"parser/include/nodes.h":        "github.com/pganalyze/pg_query_go/v2/include/nodes.h",
+		"parser/include/config_linux.h": "github.com/pganalyze/pg_query_go/v2/parser/include/config.h",
+		"v2/x.h":                        "github.com/pganalyze/pg_query_go/v2/v2/x.h",
+	} {
+		got, ok := vendorPath(mod, filepath.Join(dir, filepath.FromSlash(relPath)))
+		if !ok || got != want {
+			t.Errorf("vendorPath(%s) = %q, %v, want %q", relPath, got, ok, want)
+		}
+	}
+
+	// -strip of the v1 module doesn't apply to the v2 one
+	stripFlag = moduleFlag{"github.com/pganalyze/pg_query_go": "parser"}
+	if got, _ := vendorPath(mod, filepath.Join(dir, "parser", "x.h")); got != "github.com/pganalyze/pg_query_go/v2/parser/x.h" {
+		t.Errorf("got %s, want the v1 module's -strip not to apply", got)
+	}
+}
+
+func TestMajorVersionModuleFiles(t *testing.T) {
+	modCache := t.TempDir()
+	t.Setenv("GOMODCACHE", modCache)
+	writeTree(t, filepath.Join(modCache, "github.com", "pganalyze", "pg_query_go@v1.0.3"),
+		"parser/a.c", "src/postgres/old.h", "v2/parser/stale.c")
+	writeTree(t, filepath.Join(modCache, "github.com", "pganalyze", "pg_query_go", "v2@v2.1.0"),
+		"parser/b.c", "parser/include/b.h", "parserx/c.c", "src/postgres/p.h", "src/other/o.h")
+
+	modules := parseTestModulesTxt(t, `# github.com/pganalyze/pg_query_go v1.0.3
+github.com/pganalyze/pg_query_go/parser
+# github.com/pganalyze/pg_query_go/v2 v2.1.0
+## explicit
+github.com/pganalyze/pg_query_go/v2/parser
+`)
+	// The -include dir goes to the v2 module only
+	vendorplan.IncludeDirs(moduleInfos(modules), []string{"github.com/pganalyze/pg_query_go/v2/src/postgres"})
+
+	want := map[string][]string{
+		"github.com/pganalyze/pg_query_go": {
+			"github.com/pganalyze/pg_query_go/parser/a.c",
+		},
+		"github.com/pganalyze/pg_query_go/v2": {
+			"github.com/pganalyze/pg_query_go/v2/parser/b.c",
+			"github.com/pganalyze/pg_query_go/v2/parser/include/b.h",
+			"github.com/pganalyze/pg_query_go/v2/src/postgres/p.h",
+		},
+	}
+	for _, mod := range modules {
+		mod.CopyPat = []string{"**/*.c", "**/*.h"}
+		got := vendorModFiles(t, mod)
+		if strings.Join(got, " ") != strings.Join(want[mod.ImportPath], " ") {
+			t.Errorf("module %s: got vendor paths %v, want %v", mod.ImportPath, got, want[mod.ImportPath])
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Manifest records the files vendored by a modvendor run, per module, along
+// with the sha256 of their contents.
+type Manifest struct {
+	Modules []*ManifestModule `json:"modules"`
+}
+
+type ManifestModule struct {
+	ImportPath string            `json:"path"`
+	Version    string            `json:"version"`
+	Files      map[string]string `json:"files"`             // vendor/ relative path -> sha256
+	Renamed    map[string]string `json:"renamed,omitempty"` // vendor/ relative path -> module relative source path, from -rename or -filter
+	License    string            `json:"license,omitempty"`
+	Licenses   map[string]string `json:"licenses,omitempty"` // vendor/ relative path -> SPDX identifier, from -file-licenses
+}
+
+func (m *Manifest) module(importPath string) *ManifestModule {
+	for _, mm := range m.Modules {
+		if mm.ImportPath == importPath {
+			return mm
+		}
+	}
+	return nil
+}
+
+// buildManifest hashes the files of the modules as planned in fsys. File
+// licenses, if classified, are recorded too.
+func buildManifest(modules []*Mod, fsys fs.FS, fileLicenses map[string]string) (*Manifest, error) {
+	manifest := &Manifest{}
+
+	for _, mod := range modules {
+		if len(mod.VendorList) == 0 {
+			continue
+		}
+		mm := &ManifestModule{
+			ImportPath: mod.ImportPath,
+			Version:    mod.Version,
+			Files:      map[string]string{},
+			License:    mod.License,
+		}
+		for vendorFile := range mod.VendorList {
+			localPath := mod.VendorPaths[vendorFile]
+			sum, err := fsFileSHA256(fsys, localPath)
+			if err != nil {
+				return nil, fmt.Errorf("module %s: %v", mod, err)
+			}
+			mm.Files[nfc(localPath)] = sum
+			if relPath, _ := modRelPath(mod, vendorFile); mod.Renames[relPath] != "" || mod.Filtered[vendorFile] {
+				if mm.Renamed == nil {
+					mm.Renamed = map[string]string{}
+				}
+				mm.Renamed[nfc(localPath)] = relPath
+			}
+			if license, ok := fileLicenses[localPath]; ok {
+				if mm.Licenses == nil {
+					mm.Licenses = map[string]string{}
+				}
+				mm.Licenses[nfc(localPath)] = license
+			}
+		}
+		manifest.Modules = append(manifest.Modules, mm)
+	}
+
+	sort.Slice(manifest.Modules, func(i, j int) bool {
+		return manifest.Modules[i].ImportPath < manifest.Modules[j].ImportPath
+	})
+
+	return manifest, nil
+}
+
+// readManifest returns a nil manifest without error if the file doesn't exist.
+func readManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", path, err)
+	}
+	for _, mm := range manifest.Modules {
+		files := map[string]string{}
+		for file, sum := range mm.Files {
+			files[nfc(file)] = sum
+		}
+		mm.Files = files
+	}
+	return manifest, nil
+}
+
+func writeManifest(path string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// manifestChangelog compares the previous and current manifests and returns
+// one human-readable line per module whose vendored files changed, ie.
+// "module github.com/foo/bar v1.2.0→v1.3.0: 14 files added, 2 removed, 5 modified"
+func manifestChangelog(prev, cur *Manifest) []string {
+	changelog := []string{}
+
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, m := range []*Manifest{prev, cur} {
+		for _, mm := range m.Modules {
+			if !seen[mm.ImportPath] {
+				seen[mm.ImportPath] = true
+				paths = append(paths, mm.ImportPath)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		prevMod, curMod := prev.module(path), cur.module(path)
+
+		var version string
+		prevFiles, curFiles := map[string]string{}, map[string]string{}
+		switch {
+		case prevMod == nil:
+			version = curMod.Version + " (new)"
+			curFiles = curMod.Files
+		case curMod == nil:
+			version = prevMod.Version + " (removed)"
+			prevFiles = prevMod.Files
+		default:
+			version = curMod.Version
+			if prevMod.Version != curMod.Version {
+				version = prevMod.Version + "→" + curMod.Version
+			}
+			prevFiles, curFiles = prevMod.Files, curMod.Files
+		}
+
+		var added, removed, modified int
+		for file, sum := range curFiles {
+			prevSum, ok := prevFiles[file]
+			if !ok {
+				added++
+			} else if prevSum != sum {
+				modified++
+			}
+		}
+		for file := range prevFiles {
+			if _, ok := curFiles[file]; !ok {
+				removed++
+			}
+		}
+		if added == 0 && removed == 0 && modified == 0 && (prevMod == nil || curMod == nil || prevMod.Version == curMod.Version) {
+			continue
+		}
+
+		changes := []string{}
+		for _, c := range []struct {
+			n    int
+			verb string
+		}{{added, "added"}, {removed, "removed"}, {modified, "modified"}} {
+			if c.n == 0 {
+				continue
+			}
+			if len(changes) == 0 {
+				changes = append(changes, fmt.Sprintf("%d files %s", c.n, c.verb))
+			} else {
+				changes = append(changes, fmt.Sprintf("%d %s", c.n, c.verb))
+			}
+		}
+		if len(changes) == 0 {
+			changes = append(changes, "no file changes")
+		}
+		changelog = append(changelog, fmt.Sprintf("module %s %s: %s", path, version, strings.Join(changes, ", ")))
+	}
+
+	return changelog
+}
+
+// removedUpstream returns, per module whose version changed since the
+// previous manifest, the previously vendored files which don't exist in the new
+// version anymore, as opposed to those which stopped matching the patterns.
+// Files whose source path is unknown, ie. with -strip, aren't reported.
+func removedUpstream(prev, cur *Manifest, modules []*Mod) map[string][]string {
+	removed := map[string][]string{}
+	for _, mod := range modules {
+		prevMod, curMod := prev.module(mod.ImportPath), cur.module(mod.ImportPath)
+		if prevMod == nil || prevMod.Version == mod.Version {
+			continue
+		}
+		for file := range prevMod.Files {
+			if curMod != nil {
+				if _, ok := curMod.Files[file]; ok {
+					continue
+				}
+			}
+			relPath, ok := prevMod.Renamed[file]
+			if !ok {
+				if _, stripped := stripFlag[mod.ImportPath]; stripped || !strings.HasPrefix(file, mod.ImportPath+"/") {
+					continue
+				}
+				relPath = strings.TrimPrefix(file, mod.ImportPath+"/")
+			}
+			if _, err := statModFile(mod, filepath.Join(mod.Dir, filepath.FromSlash(relPath))); os.IsNotExist(err) {
+				removed[mod.ImportPath] = append(removed[mod.ImportPath], file)
+			}
+		}
+		sort.Strings(removed[mod.ImportPath])
+	}
+	return removed
+}
+
+func fsFileSHA256(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readerSHA256(f)
+}
+
+func readerSHA256(f io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumsFile is written into the vendor dir by -checksums, in sha256sum
+// format, so `cd vendor && sha256sum -c .modvendor.sha256` verifies it.
+const checksumsFile = ".modvendor.sha256"
+
+func writeChecksums(path string, manifest *Manifest) error {
+	lines := []string{}
+	for _, mm := range manifest.Modules {
+		for file, sum := range mm.Files {
+			lines = append(lines, sum+"  "+file+"\n")
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][66:] < lines[j][66:]
+	})
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "")), 0644)
+}
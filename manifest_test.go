@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestManifestChangelog(t *testing.T) {
+	mod := func(path, version string, files ...string) *ManifestModule {
+		mm := &ManifestModule{ImportPath: path, Version: version, Files: map[string]string{}}
+		for _, file := range files {
+			// name=sum, or the name as sum
+			name, sum := file, file
+			if i := strings.Index(file, "="); i >= 0 {
+				name, sum = file[:i], file[i+1:]
+			}
+			mm.Files[name] = sum
+		}
+		return mm
+	}
+
+	for _, test := range []struct {
+		name      string
+		prev, cur []*ManifestModule
+		want      []string
+	}{
+		{
+			name: "unchanged",
+			prev: []*ManifestModule{mod("github.com/a/b", "v1.0.0", "x.h", "y.h")},
+			cur:  []*ManifestModule{mod("github.com/a/b", "v1.0.0", "x.h", "y.h")},
+			want: []string{},
+		},
+		{
+			name: "new module",
+			prev: []*ManifestModule{},
+			cur:  []*ManifestModule{mod("github.com/a/b", "v1.0.0", "x.h", "y.h")},
+			want: []string{"module github.com/a/b v1.0.0 (new): 2 files added"},
+		},
+		{
+			name: "removed module",
+			prev: []*ManifestModule{mod("github.com/a/b", "v1.0.0", "x.h")},
+			cur:  []*ManifestModule{},
+			want: []string{"module github.com/a/b v1.0.0 (removed): 1 files removed"},
+		},
+		{
+			name: "upgrade",
+			prev: []*ManifestModule{mod("github.com/a/b", "v1.0.0", "x.h=1", "y.h", "z.h")},
+			cur:  []*ManifestModule{mod("github.com/a/b", "v1.1.0", "x.h=2", "y.h", "w.h", "v.h")},
+			want: []string{"module github.com/a/b v1.0.0→v1.1.0: 2 files added, 1 removed, 1 modified"},
+		},
+		{
+			name: "upgrade without file changes",
+			prev: []*ManifestModule{mod("github.com/a/b", "v1.0.0", "x.h")},
+			cur:  []*ManifestModule{mod("github.com/a/b", "v1.0.1", "x.h")},
+			want: []string{"module github.com/a/b v1.0.0→v1.0.1: no file changes"},
+		},
+		{
+			name: "files modified in place",
+			prev: []*ManifestModule{mod("github.com/a/b", "v1.0.0", "x.h=1")},
+			cur:  []*ManifestModule{mod("github.com/a/b", "v1.0.0", "x.h=2")},
+			want: []string{"module github.com/a/b v1.0.0: 1 files modified"},
+		},
+		{
+			name: "sorted by module",
+			prev: []*ManifestModule{mod("github.com/c/d", "v0.1.0", "d.h"), mod("github.com/a/b", "v1.0.0", "x.h")},
+			cur:  []*ManifestModule{mod("github.com/e/f", "v2.0.0", "f.h"), mod("github.com/a/b", "v1.0.0")},
+			want: []string{
+				"module github.com/a/b v1.0.0: 1 files removed",
+				"module github.com/c/d v0.1.0 (removed): 1 files removed",
+				"module github.com/e/f v2.0.0 (new): 1 files added",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := manifestChangelog(&Manifest{Modules: test.prev}, &Manifest{Modules: test.cur})
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got changelog\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
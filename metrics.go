@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runMetrics are the stats of a run written by -metrics.
+type runMetrics struct {
+	command  string
+	module   string // main module path, to tell repos apart
+	start    time.Time
+	files    int
+	bytes    int64
+	failures int
+}
+
+// writeMetrics writes the metrics in the Prometheus text format, ie. for the
+// node_exporter textfile collector. The file is replaced atomically so the
+// collector never reads a partial one.
+func writeMetrics(outPath string, m *runMetrics, code int) error {
+	labels := fmt.Sprintf(`{command=%q,module=%q}`, m.command, m.module)
+	var buf bytes.Buffer
+	for _, metric := range []struct {
+		name, help string
+		value      interface{}
+	}{
+		{"modvendor_run_duration_seconds", "Duration of the modvendor run.", time.Since(m.start).Seconds()},
+		{"modvendor_files_copied", "Files copied by the modvendor run.", m.files},
+		{"modvendor_bytes_copied", "Bytes copied by the modvendor run.", m.bytes},
+		{"modvendor_failures", "Failures of the modvendor run.", m.failures},
+		{"modvendor_exit_code", "Exit code of the modvendor run.", code},
+		{"modvendor_last_run_timestamp_seconds", "Unix time the modvendor run started.", m.start.Unix()},
+	} {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s%s %v\n", metric.name, metric.help, metric.name, metric.name, labels, metric.value)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(outPath), ".modvendor-metrics-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(buf.Bytes())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), outPath)
+}
+
+// goModPath returns the module path declared by the go.mod file, or "".
+func goModPath(goModFile string) string {
+	f, err := os.Open(goModFile)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
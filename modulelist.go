@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// moduleList is an allow/deny list of module path patterns, from -module-list.
+type moduleList struct {
+	allow, deny []string
+}
+
+// parseModuleList reads "allow <pattern>" and "deny <pattern>" lines, with #
+// comments. Patterns are globs matching a prefix of the module path by
+// elements, as with GOPRIVATE, so github.com/acme matches all its modules
+// and github.com/*/internal-* the internal-* repos of any owner.
+func parseModuleList(filePath string) (*moduleList, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	list := &moduleList{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected allow <pattern> or deny <pattern>", filePath, n)
+		}
+		if _, err := path.Match(fields[1], ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %s: %v", filePath, n, fields[1], err)
+		}
+		switch fields[0] {
+		case "allow":
+			list.allow = append(list.allow, fields[1])
+		case "deny":
+			list.deny = append(list.deny, fields[1])
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown rule %q, expected allow or deny", filePath, n, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// allowed reports whether the module may contribute vendored files: it must
+// not match a deny pattern, and must match an allow pattern if there are any.
+func (l *moduleList) allowed(importPath string) bool {
+	for _, pat := range l.deny {
+		if matchPathPrefix(pat, importPath) {
+			return false
+		}
+	}
+	if len(l.allow) == 0 {
+		return true
+	}
+	for _, pat := range l.allow {
+		if matchPathPrefix(pat, importPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPrefix reports whether the glob matches the import path, or one
+// of its parent paths.
+func matchPathPrefix(pat, importPath string) bool {
+	n := len(strings.Split(pat, "/"))
+	segs := strings.Split(importPath, "/")
+	if len(segs) < n {
+		return false
+	}
+	ok, _ := path.Match(pat, strings.Join(segs[:n], "/"))
+	return ok
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// parseModulesTxt parses the modules and their packages from a
+// ./vendor/modules.txt file, as written by `go mod vendor`.
+func parseModulesTxt(modtxtPath string) ([]*Mod, error) {
+	infos, err := vendorplan.ParseModulesFile(modtxtPath)
+	if err != nil {
+		return nil, err
+	}
+	modules := make([]*Mod, len(infos))
+	for i, info := range infos {
+		modules[i] = &Mod{ModuleInfo: *info}
+	}
+	return modules, nil
+}
+
+// goListModule is the subset of `go list -m -json` output we use
+type goListModule struct {
+	Path     string
+	Version  string
+	Dir      string
+	Main     bool
+	Indirect bool
+	Replace  *goListModule
+}
+
+// goListModules derives the modules, their dirs and the packages we use of
+// them from the go command, as an alternative to parsing modules.txt. Unlike
+// `go mod vendor`, packages are only listed for the current build constraints.
+func goListModules() ([]*Mod, error) {
+	out, err := goCmd("list", "-mod=mod", "-m", "-json", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	modules := []*Mod{}
+	byPath := map[string]*Mod{}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m goListModule
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("go list -m: %v", err)
+		}
+		if m.Main {
+			continue
+		}
+
+		mod := &Mod{ModuleInfo: vendorplan.ModuleInfo{
+			ImportPath: m.Path,
+			Version:    m.Version,
+			Explicit:   !m.Indirect,
+			Dir:        m.Dir,
+		}}
+		if m.Replace != nil {
+			mod.SourcePath = m.Replace.Path
+			mod.SourceVersion = m.Replace.Version
+			if m.Replace.Dir != "" {
+				mod.Dir = m.Replace.Dir
+			}
+		}
+		if mod.Dir == "" {
+			// Not downloaded, which is reported as a missing module dir later
+			if mod.SourceVersion != "" {
+				mod.Dir = vendorplan.ModCachePath(mod.SourcePath, mod.SourceVersion)
+			} else {
+				mod.Dir = vendorplan.ModCachePath(mod.ImportPath, mod.Version)
+			}
+		}
+		modules = append(modules, mod)
+		byPath[mod.ImportPath] = mod
+	}
+
+	// Packages of the main module's dependencies, including of its tests
+	out, err = goCmd("list", "-mod=mod", "-deps", "-test", "-f", "{{if .Module}}{{.Module.Path}} {{.ImportPath}}{{end}}", "./...")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		s := strings.Fields(line)
+		if len(s) != 2 || seen[s[1]] {
+			continue
+		}
+		seen[s[1]] = true
+		if mod, ok := byPath[s[0]]; ok {
+			mod.Pkgs = append(mod.Pkgs, s[1])
+		}
+	}
+
+	return modules, nil
+}
+
+// goCmd runs the go command with args, returning its stdout.
+func goCmd(args ...string) ([]byte, error) {
+	return goCmdIn("", args...)
+}
+
+// goCmdIn runs the go command with args in dir, returning its stdout.
+func goCmdIn(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// detectVendorDir returns the vendor directory configured via `-o=dir` in
+// GOFLAGS (as set in the environment or by `go env -w`), for projects using
+// `go mod vendor -o`, or the default "vendor".
+func detectVendorDir() string {
+	for _, f := range goFlags() {
+		if strings.HasPrefix(f, "-o=") {
+			return filepath.Clean(f[len("-o="):])
+		}
+	}
+	return "vendor"
+}
+
+// -replace-source values
+const (
+	replaceSourceReplacement = "replacement"
+	replaceSourceOriginal    = "original"
+)
+
+// useOriginalSource makes a replaced module source its files from the
+// original module version, as listed before the replacement, rather than from
+// the replacement, downloading it if needed.
+func useOriginalSource(mod *Mod) error {
+	mod.SourcePath, mod.SourceVersion = "", ""
+	mod.Dir = vendorplan.ModCachePath(mod.ImportPath, mod.Version)
+	if _, err := os.Stat(mod.Dir); err == nil || findModZip(mod) != nil {
+		return nil
+	}
+	m, err := downloadModule(mod.ImportPath, mod.Version)
+	if err != nil {
+		return err
+	}
+	mod.Dir = m.Dir
+	return nil
+}
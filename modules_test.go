@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// writeTree writes files at the slash separated paths below dir, with their
+// paths as contents.
+func writeTree(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, name := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// parseTestModulesTxt parses a modules.txt with the given contents.
+func parseTestModulesTxt(t *testing.T, modulesTxt string) []*Mod {
+	t.Helper()
+	modtxtPath := filepath.Join(t.TempDir(), "modules.txt")
+	if err := ioutil.WriteFile(modtxtPath, []byte(modulesTxt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modules, err := parseModulesTxt(modtxtPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return modules
+}
+
+// vendorModFiles globs the files of the module matching its copy patterns,
+// as a run does, and returns their sorted ./vendor/ relative paths, setting
+// its vendor list.
+func vendorModFiles(t *testing.T, mod *Mod) []string {
+	t.Helper()
+	matches, err := vendorplan.Glob(mod.Dir, mod.CopyPat, 0, modPkgFilter(mod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod.VendorList = map[string]bool{}
+	mod.VendorPaths = map[string]string{}
+	paths := []string{}
+	for vendorFile := range matches {
+		localPath, ok := vendorPath(mod, vendorFile)
+		if !ok {
+			t.Fatalf("%s is outside of module dir %s", vendorFile, mod.Dir)
+		}
+		mod.VendorList[vendorFile] = true
+		mod.VendorPaths[vendorFile] = localPath
+		paths = append(paths, localPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestReplacedModuleFiles(t *testing.T) {
+	modCache := t.TempDir()
+	t.Setenv("GOMODCACHE", modCache)
+	localDir := filepath.Join(t.TempDir(), "local")
+
+	files := []string{"include/x.h", "pkg/y.h", "pkgx/z.h", "pkg/y.go"}
+	writeTree(t, filepath.Join(modCache, "github.com", "c", "d@v1.0.0"), files...)
+	writeTree(t, filepath.Join(modCache, "github.com", "!c", "d@v1.0.0"), files...)
+	writeTree(t, filepath.Join(modCache, "github.com", "a", "b@v1.1.0"), files...)
+	writeTree(t, filepath.Join(modCache, "github.com", "a", "b@v1.2.0", "include"), "wrong.h")
+	writeTree(t, localDir, files...)
+
+	for _, test := range []struct {
+		name    string
+		module  string // modules.txt module line
+		pkgs    []string
+		wantDir string
+		want    []string
+	}{
+		{
+			name:    "another module path",
+			module:  "# github.com/a/b v1.2.0 => github.com/c/d v1.0.0",
+			pkgs:    []string{"github.com/a/b"},
+			wantDir: filepath.Join(modCache, "github.com", "c", "d@v1.0.0"),
+			want:    []string{"github.com/a/b/include/x.h", "github.com/a/b/pkg/y.h", "github.com/a/b/pkgx/z.h"},
+		},
+		{
+			name:    "another module path, used packages only",
+			module:  "# github.com/a/b v1.2.0 => github.com/c/d v1.0.0",
+			pkgs:    []string{"github.com/a/b/pkg"},
+			wantDir: filepath.Join(modCache, "github.com", "c", "d@v1.0.0"),
+			want:    []string{"github.com/a/b/pkg/y.h"},
+		},
+		{
+			name:    "another module path with upper case",
+			module:  "# github.com/a/b v1.2.0 => github.com/C/d v1.0.0",
+			pkgs:    []string{"github.com/a/b/pkg"},
+			wantDir: filepath.Join(modCache, "github.com", "!c", "d@v1.0.0"),
+			want:    []string{"github.com/a/b/pkg/y.h"},
+		},
+		{
+			name:    "another version",
+			module:  "# github.com/a/b v1.2.0 => github.com/a/b v1.1.0",
+			pkgs:    []string{"github.com/a/b"},
+			wantDir: filepath.Join(modCache, "github.com", "a", "b@v1.1.0"),
+			want:    []string{"github.com/a/b/include/x.h", "github.com/a/b/pkg/y.h", "github.com/a/b/pkgx/z.h"},
+		},
+		{
+			name:    "local dir",
+			module:  "# github.com/a/b v1.2.0 => " + localDir,
+			pkgs:    []string{"github.com/a/b/pkg"},
+			wantDir: localDir,
+			want:    []string{"github.com/a/b/pkg/y.h"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			modules := parseTestModulesTxt(t, test.module+"\n"+strings.Join(test.pkgs, "\n")+"\n")
+			if len(modules) != 1 {
+				t.Fatalf("got %d modules, want 1", len(modules))
+			}
+			mod := modules[0]
+			if mod.ImportPath != "github.com/a/b" || mod.Dir != test.wantDir {
+				t.Fatalf("got module %s in %s, want github.com/a/b in %s", mod.ImportPath, mod.Dir, test.wantDir)
+			}
+
+			mod.CopyPat = []string{"**/*.h"}
+			got := vendorModFiles(t, mod)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Fatalf("got vendor paths %v, want %v", got, test.want)
+			}
+
+			// Files are read from the replacement and written under the
+			// original import path
+			vendorDir := filepath.Join(t.TempDir(), "vendor")
+			actions, err := planCopy(modules, vendorDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(actions) != len(test.want) {
+				t.Fatalf("got %d copy actions, want %d", len(actions), len(test.want))
+			}
+			for i, action := range actions {
+				if action.Destination != test.want[i] {
+					t.Errorf("got destination %s, want %s", action.Destination, test.want[i])
+				}
+				rel := strings.TrimPrefix(test.want[i], "github.com/a/b/")
+				if wantSource := filepath.Join(test.wantDir, filepath.FromSlash(rel)); action.Source != wantSource {
+					t.Errorf("%s: got source %s, want %s", action.Destination, action.Source, wantSource)
+				}
+			}
+
+			fail := func(code int, format string, args ...interface{}) {
+				t.Errorf(format, args...)
+			}
+			applyCopy(actions, vendorDir, newRollback(t.TempDir()), nil, fail)
+			for _, localPath := range test.want {
+				data, err := ioutil.ReadFile(filepath.Join(vendorDir, filepath.FromSlash(localPath)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := strings.TrimPrefix(localPath, "github.com/a/b/"); string(data) != want {
+					t.Errorf("%s: got contents %q, want those of the replacement's %s", localPath, data, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// moduleSetFlag is a flag applying to all modules as a plain boolean flag, ie.
+// -all-files, or to the modules given by path, ie. -all-files=<module>, can
+// be repeated.
+type moduleSetFlag struct {
+	all     bool
+	modules map[string]bool
+}
+
+func (f *moduleSetFlag) String() string {
+	if f.all {
+		return "true"
+	}
+	mods := []string{}
+	for mod := range f.modules {
+		mods = append(mods, mod)
+	}
+	sort.Strings(mods)
+	return strings.Join(mods, ",")
+}
+
+func (f *moduleSetFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.all = true
+	case "false":
+		f.all = false
+	default:
+		if f.modules == nil {
+			f.modules = map[string]bool{}
+		}
+		for _, mod := range strings.Split(value, ",") {
+			if mod = strings.TrimSpace(mod); mod != "" {
+				f.modules[mod] = true
+			}
+		}
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (f *moduleSetFlag) IsBoolFlag() bool { return true }
+
+// applies reports whether the flag is set for the module.
+func (f *moduleSetFlag) applies(importPath string) bool {
+	return f.all || f.modules[importPath]
+}
+
+// providesFiles reports whether files are vendored from the module: it must
+// provide packages, or be an -asset-modules module.
+func providesFiles(mod *Mod) bool {
+	return len(mod.Pkgs) > 0 || assetModules.applies(mod.ImportPath)
+}
@@ -0,0 +1,233 @@
+// Package modvendortest checks from Go tests that the files modvendor would
+// vendor are in place and up to date, ie.
+//
+//	func TestVendor(t *testing.T) {
+//		modvendortest.AssertVendorComplete(t, modvendortest.Config{
+//			Args: []string{"-copy=**/*.c **/*.h"},
+//		})
+//	}
+//
+// It runs `modvendor -plan` with the same flags as the project's modvendor
+// invocation, and compares the planned files with those vendored, so the
+// modvendor command needs to be installed. Tests are skipped if it isn't.
+package modvendortest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Config is how the project runs modvendor.
+type Config struct {
+	Dir     string   // project dir, by default the closest dir up from the current one with a go.mod
+	Command string   // modvendor command, by default modvendor from $PATH
+	Args    []string // modvendor flags, ie. "-copy=**/*.c **/*.h"
+
+	// Manifest is the modvendor manifest, relative to Dir, by default the
+	// -manifest of Args. Files recorded in it which modvendor doesn't vendor
+	// anymore are reported as stale.
+	Manifest string
+}
+
+// copyAction is the subset of the -plan output we use.
+type copyAction struct {
+	Module      string `json:"module"`
+	Source      string `json:"source"`
+	Dir         string `json:"dir"`
+	Destination string `json:"destination"`
+}
+
+// manifest is the subset of the -manifest we use.
+type manifest struct {
+	Modules []struct {
+		Files map[string]string `json:"files"`
+	} `json:"modules"`
+}
+
+// AssertVendorComplete fails the test for each file modvendor would vendor
+// which is missing, or differs from its module's version, and for each stale
+// file of the manifest still in the vendor dir.
+func AssertVendorComplete(t testing.TB, cfg Config) {
+	t.Helper()
+	dir := cfg.Dir
+	if dir == "" {
+		var err error
+		if dir, err = projectDir(); err != nil {
+			t.Fatalf("modvendortest: %v", err)
+		}
+	}
+	command := cfg.Command
+	if command == "" {
+		command = "modvendor"
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		t.Skipf("modvendortest: %s not found, install it with go install github.com/goware/modvendor@latest", command)
+	}
+
+	cmd := exec.Command(command, append(append([]string{}, cfg.Args...), "-plan")...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("modvendortest: %s -plan: %v\n%s", command, err, out)
+	}
+	actions, err := parsePlan(out)
+	if err != nil {
+		t.Fatalf("modvendortest: %s -plan: %v", command, err)
+	}
+
+	planned := map[string]bool{}
+	for _, a := range actions {
+		dst := filepath.Join(a.Dir, filepath.FromSlash(a.Destination))
+		if !filepath.IsAbs(dst) {
+			dst = filepath.Join(dir, dst)
+		}
+		planned[dst] = true
+		got, err := ioutil.ReadFile(dst)
+		if os.IsNotExist(err) {
+			t.Errorf("%s of %s is not vendored, run modvendor", a.Destination, a.Module)
+			continue
+		}
+		if err != nil {
+			t.Errorf("modvendortest: %v", err)
+			continue
+		}
+		want, err := readSource(a.Source)
+		if err != nil {
+			t.Errorf("modvendortest: %s of %s: %v", a.Destination, a.Module, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from %s, run modvendor", a.Destination, a.Module)
+		}
+	}
+
+	manifestPath := cfg.Manifest
+	if manifestPath == "" {
+		manifestPath = flagValue(cfg.Args, "manifest")
+	}
+	if manifestPath == "" {
+		return
+	}
+	if !filepath.IsAbs(manifestPath) {
+		manifestPath = filepath.Join(dir, manifestPath)
+	}
+	data, err := ioutil.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		t.Fatalf("modvendortest: %v", err)
+	}
+	m := manifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("modvendortest: invalid manifest %s: %v", manifestPath, err)
+	}
+	vendorDir := flagValue(cfg.Args, "vendor-dir")
+	if vendorDir == "" {
+		vendorDir = "vendor"
+	}
+	if !filepath.IsAbs(vendorDir) {
+		vendorDir = filepath.Join(dir, vendorDir)
+	}
+	stale := []string{}
+	for _, mm := range m.Modules {
+		for file := range mm.Files {
+			dst := filepath.Join(vendorDir, filepath.FromSlash(file))
+			if planned[dst] {
+				continue
+			}
+			if _, err := os.Lstat(dst); err == nil {
+				stale = append(stale, file)
+			}
+		}
+	}
+	sort.Strings(stale)
+	for _, file := range stale {
+		t.Errorf("%s is stale, modvendor doesn't vendor it anymore, run modvendor -prune", file)
+	}
+}
+
+// flagValue returns the value of the flag in args, given as -name=value,
+// --name=value, -name value or --name value, the last one winning.
+func flagValue(args []string, name string) string {
+	value := ""
+	for i, arg := range args {
+		arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if strings.HasPrefix(arg, name+"=") {
+			value = arg[len(name)+1:]
+		} else if arg == name && i+1 < len(args) {
+			value = args[i+1]
+		}
+	}
+	return value
+}
+
+// parsePlan decodes the JSON plan, which follows any warnings modvendor
+// prints.
+func parsePlan(out []byte) ([]copyAction, error) {
+	i := bytes.Index(out, []byte("\n["))
+	if bytes.HasPrefix(out, []byte("[")) {
+		i = 0
+	} else if i < 0 {
+		return nil, fmt.Errorf("no plan in output:\n%s", out)
+	}
+	actions := []copyAction{}
+	if err := json.Unmarshal(out[i:], &actions); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// readSource reads the source of a copy, a file or a module zip entry as
+// path#entry.
+func readSource(source string) ([]byte, error) {
+	if i := strings.LastIndex(source, ".zip#"); i >= 0 {
+		zipPath, entry := source[:i+len(".zip")], source[i+len(".zip#"):]
+		zr, err := zip.OpenReader(zipPath)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		// Entries of module zips are prefixed with module@version/
+		for _, f := range zr.File {
+			at := strings.Index(f.Name, "@")
+			if at < 0 {
+				continue
+			}
+			if j := strings.Index(f.Name[at:], "/"); j >= 0 && f.Name[at+j+1:] == entry {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return ioutil.ReadAll(rc)
+			}
+		}
+		return nil, fmt.Errorf("%s not found in %s", entry, zipPath)
+	}
+	return ioutil.ReadFile(source)
+}
+
+func projectDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("no go.mod in %s or above", dir)
+		}
+	}
+}
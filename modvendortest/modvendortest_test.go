@@ -0,0 +1,146 @@
+package modvendortest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// recorder records the failures of an assertion instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors  []string
+	skipped string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (r *recorder) Skipf(format string, args ...interface{}) {
+	r.skipped = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func assertVendorComplete(t *testing.T, cfg Config) *recorder {
+	r := &recorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		AssertVendorComplete(r, cfg)
+	}()
+	<-done
+	return r
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testProject returns a project dir, and a fake modvendor printing a plan of
+// the files of a module, following a warning.
+func testProject(t *testing.T) (string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake modvendor is a shell script")
+	}
+	modDir := t.TempDir()
+	writeFiles(t, modDir, map[string]string{"x.h": "x", "y.h": "y"})
+	plan := []copyAction{}
+	for _, name := range []string{"x.h", "y.h"} {
+		plan = append(plan, copyAction{
+			Module:      "github.com/a/b@v1.0.0",
+			Source:      filepath.Join(modDir, name),
+			Dir:         "vendor",
+			Destination: "github.com/a/b/" + name,
+		})
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := filepath.Join(t.TempDir(), "modvendor")
+	script := "#!/bin/sh\necho 'Warning! something'\ncat <<'EOF'\n" + string(data) + "\nEOF\n"
+	if err := ioutil.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":                     "module example.com/p\n",
+		"vendor/modules.txt":         "# github.com/a/b v1.0.0\n",
+		"vendor/github.com/a/b/x.h":  "x",
+		"vendor/github.com/a/b/y.h":  "y",
+		"vendor/github.com/a/b/b.go": "package b\n",
+		"modvendor.json":             `{"modules":[{"path":"github.com/a/b","version":"v1.0.0","files":{"github.com/a/b/x.h":"","github.com/a/b/y.h":""}}]}`,
+	})
+	return dir, command
+}
+
+func TestAssertVendorComplete(t *testing.T) {
+	dir, command := testProject(t)
+	r := assertVendorComplete(t, Config{Dir: dir, Command: command, Args: []string{"-copy=**/*.h", "-manifest=modvendor.json"}})
+	if len(r.errors) != 0 || r.skipped != "" {
+		t.Errorf("got errors %v, skipped %q, want none", r.errors, r.skipped)
+	}
+}
+
+func TestAssertVendorCompleteFailures(t *testing.T) {
+	dir, command := testProject(t)
+	writeFiles(t, dir, map[string]string{
+		"vendor/github.com/a/b/y.h":   "old y",
+		"vendor/github.com/a/b/old.h": "old",
+		"modvendor.json":              `{"modules":[{"path":"github.com/a/b","version":"v0.9.0","files":{"github.com/a/b/y.h":"","github.com/a/b/old.h":"","github.com/a/b/gone.h":""}}]}`,
+	})
+	if err := os.Remove(filepath.Join(dir, "vendor", "github.com", "a", "b", "x.h")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"-copy=**/*.h", "-manifest=modvendor.json"},
+		{"-copy=**/*.h", "--manifest", filepath.Join(dir, "modvendor.json")},
+	} {
+		r := assertVendorComplete(t, Config{Dir: dir, Command: command, Args: args})
+		want := []string{
+			"github.com/a/b/x.h of github.com/a/b@v1.0.0 is not vendored, run modvendor",
+			"github.com/a/b/y.h differs from github.com/a/b@v1.0.0, run modvendor",
+			"github.com/a/b/old.h is stale, modvendor doesn't vendor it anymore, run modvendor -prune",
+		}
+		if strings.Join(r.errors, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%v: got errors\n%s\nwant\n%s", args, strings.Join(r.errors, "\n"), strings.Join(want, "\n"))
+		}
+	}
+
+	// Without a manifest, stale files aren't known
+	r := assertVendorComplete(t, Config{Dir: dir, Command: command, Args: []string{"-copy=**/*.h"}})
+	if len(r.errors) != 2 {
+		t.Errorf("got errors %v, want the missing and differing files only", r.errors)
+	}
+}
+
+func TestAssertVendorCompleteNoCommand(t *testing.T) {
+	r := assertVendorComplete(t, Config{Dir: t.TempDir(), Command: filepath.Join(t.TempDir(), "modvendor")})
+	if !strings.Contains(r.skipped, "not found, install it") || len(r.errors) != 0 {
+		t.Errorf("got skipped %q, errors %v, want the test skipped", r.skipped, r.errors)
+	}
+}
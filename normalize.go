@@ -0,0 +1,12 @@
+package main
+
+import (
+	"golang.org/x/text/unicode/norm"
+)
+
+// nfc returns the NFC normalized form of a path. On macOS, HFS+ stores (and
+// APFS may return) file names in NFD form, while module zips, patterns and
+// manifests use NFC, so paths are normalized before being matched or compared.
+func nfc(p string) string {
+	return norm.NFC.String(p)
+}
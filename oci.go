@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Bundles of vendored files are stored as OCI artifacts with the oras
+// command, as a single gzipped tar layer.
+const (
+	ociArtifactType = "application/vnd.goware.modvendor.v1"
+	ociBundleType   = "application/vnd.goware.modvendor.bundle.v1.tar+gzip"
+	ociBundleName   = "modvendor-bundle.tar.gz"
+)
+
+// ociRef returns the registry reference of an oci://registry/repo:tag URL.
+func ociRef(url string) (string, error) {
+	ref := strings.TrimPrefix(url, "oci://")
+	if ref == url || ref == "" {
+		return "", fmt.Errorf("invalid OCI reference %q, expected oci://registry/repo:tag", url)
+	}
+	return ref, nil
+}
+
+// pushOCI uploads the files, relative to the project dir, as an OCI
+// artifact.
+func pushOCI(ref string, files []string) error {
+	tmpDir, err := ioutil.TempDir("", "modvendor-oci")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	f, err := os.Create(filepath.Join(tmpDir, ociBundleName))
+	if err != nil {
+		return err
+	}
+	err = writeBundle(f, files)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// oras records the file name as given, so it's pushed from its dir
+	cmd := exec.Command("oras", "push", ref, "--artifact-type", ociArtifactType, ociBundleName+":"+ociBundleType)
+	cmd.Dir = tmpDir
+	return runCopyCmd(cmd)
+}
+
+// pullOCI downloads an OCI artifact pushed by pushOCI, and extracts its files
+// into the project dir, only accepting files below the roots.
+func pullOCI(ref string, roots []string) ([]string, error) {
+	tmpDir, err := ioutil.TempDir("", "modvendor-oci")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := runCopyCmd(exec.Command("oras", "pull", ref, "--output", tmpDir)); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(tmpDir, ociBundleName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s is not a modvendor bundle", ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return extractBundle(f, ".", roots)
+}
+
+// manifestFiles returns the files recorded in the manifest, relative to the
+// project dir.
+func manifestFiles(vendorDir string, manifest *Manifest) []string {
+	files := []string{}
+	for _, mm := range manifest.Modules {
+		for localPath := range mm.Files {
+			files = append(files, filepath.Join(vendorDir, filepath.FromSlash(localPath)))
+		}
+	}
+	return files
+}
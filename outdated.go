@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// outdatedModule is a module whose files in the manifest were vendored from
+// another version than the one the project now uses, as reported by
+// `modvendor outdated`. Current is empty for modules not used anymore.
+type outdatedModule struct {
+	Path     string `json:"path"`
+	Vendored string `json:"vendored"`
+	Current  string `json:"current,omitempty"`
+	Files    int    `json:"files"`
+}
+
+// outdatedModules compares the versions recorded in the manifest with those
+// of the modules, taking -override versions into account, in manifest order.
+func outdatedModules(manifest *Manifest, modules []*Mod, overrides map[string]string) []outdatedModule {
+	current := map[string]string{}
+	for _, mod := range modules {
+		current[mod.ImportPath] = mod.Version
+		if version, ok := overrides[mod.ImportPath]; ok {
+			current[mod.ImportPath] = version
+		}
+	}
+	outdated := []outdatedModule{}
+	for _, mm := range manifest.Modules {
+		if len(mm.Files) == 0 || current[mm.ImportPath] == mm.Version {
+			continue
+		}
+		outdated = append(outdated, outdatedModule{Path: mm.ImportPath, Vendored: mm.Version, Current: current[mm.ImportPath], Files: len(mm.Files)})
+	}
+	return outdated
+}
+
+func printOutdated(w io.Writer, outdated []outdatedModule, asJSON bool) {
+	if asJSON {
+		data, _ := json.MarshalIndent(outdated, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return
+	}
+	for _, m := range outdated {
+		if m.Current == "" {
+			fmt.Fprintf(w, "removed   %s %s (%d files)\n", m.Path, m.Vendored, m.Files)
+		} else {
+			fmt.Fprintf(w, "outdated  %s %s→%s (%d files)\n", m.Path, m.Vendored, m.Current, m.Files)
+		}
+	}
+}
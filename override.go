@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// overrideFlag is a repeatable flag of <module>@<version> pairs.
+type overrideFlag map[string]string
+
+func (f overrideFlag) String() string {
+	pairs := []string{}
+	for mod, version := range f {
+		pairs = append(pairs, mod+"@"+version)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f overrideFlag) Set(value string) error {
+	i := strings.LastIndex(value, "@")
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("expected <module>@<version>")
+	}
+	f[value[:i]] = value[i+1:]
+	return nil
+}
+
+// overrideModule switches mod to the given version, downloading it if
+// needed, so its files are vendored from that version instead of the one in
+// modules.txt.
+func overrideModule(mod *Mod, version string) error {
+	m, err := downloadModule(mod.ImportPath, version)
+	if err != nil {
+		return err
+	}
+	mod.Version, mod.Dir = m.Version, m.Dir
+	mod.SourcePath, mod.SourceVersion = "", ""
+	return nil
+}
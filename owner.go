@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ownerPreserve gives copied files the owner of their source in the module
+// cache (or its module zip), and created directories that of their parent.
+const ownerPreserve = "preserve"
+
+// ownerSpec is the owner of copied files and created directories from
+// -owner, ie. when running as root in image builds.
+type ownerSpec struct {
+	preserve bool
+	uid, gid int // -1 to leave unchanged
+}
+
+// owner is set from -owner, nil to leave ownership to the OS.
+var owner *ownerSpec
+
+// parseOwner parses "preserve" or <user>[:<group>], by name or id. Without
+// a group, a user given by name gets their primary group.
+func parseOwner(s string) (*ownerSpec, error) {
+	if s == ownerPreserve {
+		return &ownerSpec{preserve: true}, nil
+	}
+	userName, groupName := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		userName, groupName = s[:i], s[i+1:]
+	}
+	o := &ownerSpec{uid: -1, gid: -1}
+	if userName != "" {
+		if uid, err := strconv.Atoi(userName); err == nil {
+			o.uid = uid
+		} else {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return nil, err
+			}
+			if o.uid, err = strconv.Atoi(u.Uid); err != nil {
+				return nil, fmt.Errorf("user %s has non-numeric uid %s", userName, u.Uid)
+			}
+			if groupName == "" {
+				groupName = u.Gid
+			}
+		}
+	}
+	if groupName != "" {
+		if gid, err := strconv.Atoi(groupName); err == nil {
+			o.gid = gid
+		} else {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return nil, err
+			}
+			if o.gid, err = strconv.Atoi(g.Gid); err != nil {
+				return nil, fmt.Errorf("group %s has non-numeric gid %s", groupName, g.Gid)
+			}
+		}
+	}
+	if o.uid < 0 && o.gid < 0 {
+		return nil, fmt.Errorf("%q names neither a user nor a group", s)
+	}
+	return o, nil
+}
+
+// chown sets the owner of path, preserving that of the file from.
+func (o *ownerSpec) chown(path, from string) error {
+	uid, gid := o.uid, o.gid
+	if o.preserve {
+		info, err := os.Stat(longPath(from))
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if uid, gid, ok = fileOwner(info); !ok {
+			return nil
+		}
+	}
+	return os.Lchown(longPath(path), uid, gid)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Mode bits -permission-policy keeps out of the vendor dir, unless allowed
+// with -permission-allow.
+const (
+	permSetuid        = "setuid"
+	permSetgid        = "setgid"
+	permWorldWritable = "world-writable"
+)
+
+var permissionKinds = []string{permSetuid, permSetgid, permWorldWritable}
+
+// Permission policies, for -permission-policy.
+const (
+	permissionWarn = "warn" // vendor files anyway, with a warning
+	permissionSkip = "skip" // don't vendor them, with a warning
+	permissionFail = "fail" // fail the run
+)
+
+// permissionIssues returns the dangerous mode bits of a file, except allowed
+// ones.
+func permissionIssues(mode os.FileMode, allowed map[string]bool) []string {
+	issues := []string{}
+	for _, issue := range []struct {
+		kind string
+		set  bool
+	}{
+		{permSetuid, mode&os.ModeSetuid != 0},
+		{permSetgid, mode&os.ModeSetgid != 0},
+		{permWorldWritable, mode.Perm()&0002 != 0},
+	} {
+		if issue.set && !allowed[issue.kind] {
+			issues = append(issues, issue.kind)
+		}
+	}
+	return issues
+}
+
+// parsePermissionAllow parses the comma separated -permission-allow kinds.
+func parsePermissionAllow(value string) (map[string]bool, error) {
+	allowed := map[string]bool{}
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" {
+			continue
+		}
+		known := false
+		for _, k := range permissionKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown -permission-allow kind %q, expected %s", kind, strings.Join(permissionKinds, ", "))
+		}
+		allowed[kind] = true
+	}
+	return allowed, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// CopyAction is a single file copy planned by modvendor, as printed by -plan,
+// along with the module file it copies.
+type CopyAction struct {
+	vendorplan.CopyAction
+
+	mod        *Mod
+	vendorFile string
+}
+
+// modSource reads the files of a module from its dir or zip.
+type modSource struct {
+	mod *Mod
+}
+
+func (s modSource) Open(vendorFile string) (io.ReadCloser, os.FileInfo, error) {
+	return openModFile(s.mod, vendorFile)
+}
+
+func (s modSource) Stat(vendorFile string) (os.FileInfo, error) {
+	return statModFile(s.mod, vendorFile)
+}
+
+// planConfig returns the vendorplan config for the vendor lists of the
+// modules, along with the module of each file.
+func planConfig(modules []*Mod, vendorDir string) (vendorplan.Config, map[*vendorplan.File]*Mod) {
+	cfg := vendorplan.Config{VendorDir: vendorDir}
+	mods := map[*vendorplan.File]*Mod{}
+	for _, mod := range modules {
+		m := &vendorplan.Module{Name: mod.String(), Source: modSource{mod}}
+		for vendorFile := range mod.VendorList {
+			f := &vendorplan.File{
+				Path:        vendorFile,
+				Destination: mod.VendorPaths[vendorFile],
+				Reason:      "pattern " + matchingPattern(mod, vendorFile),
+			}
+			m.Files = append(m.Files, f)
+			mods[f] = mod
+		}
+		cfg.Modules = append(cfg.Modules, m)
+	}
+	return cfg, mods
+}
+
+// planCopy returns the copy actions for the vendor lists of the modules,
+// ordered by destination. Nothing is written.
+func planCopy(modules []*Mod, vendorDir string) ([]*CopyAction, error) {
+	cfg, mods := planConfig(modules, vendorDir)
+	planned, err := vendorplan.Plan(cfg)
+	if err != nil {
+		var fileErr *vendorplan.FileError
+		if errors.As(err, &fileErr) {
+			return nil, errors.New(fileError(mods[fileErr.File], fileErr.File.Path, fileErr.Op, fileErr.Err))
+		}
+		return nil, err
+	}
+	actions := make([]*CopyAction, len(planned))
+	for i, a := range planned {
+		mod := mods[a.File()]
+		if mod.Zip != nil {
+			relPath, _ := modRelPath(mod, a.Source)
+			a.Source = mod.Zip.Path + "#" + relPath
+		}
+		actions[i] = &CopyAction{CopyAction: *a, mod: mod, vendorFile: a.File().Path}
+	}
+	return actions, nil
+}
+
+// plannedFS returns a read-only fs.FS over the vendor dir as planned by the
+// vendor lists of the modules.
+func plannedFS(modules []*Mod, vendorDir string) (fs.FS, error) {
+	cfg, _ := planConfig(modules, vendorDir)
+	return vendorplan.FS(cfg)
+}
+
+// applyCopy executes the copy actions, recording the changes in rollback.
+// Failed copies are reported through fail and dropped from their module's
+// vendor list. Progress is reported to progress, if set.
+func applyCopy(actions []*CopyAction, vendorDir string, rollback *Rollback, progress progressReporter, fail func(code int, format string, args ...interface{})) (files int, bytes int64) {
+	planned := make([]*vendorplan.CopyAction, len(actions))
+	byAction := map[*vendorplan.CopyAction]*CopyAction{}
+	for i, action := range actions {
+		planned[i] = &action.CopyAction
+		byAction[planned[i]] = action
+	}
+	attempted := map[*CopyAction]bool{}
+
+	applier := &vendorplan.Applier{
+		Prepare: func(a *vendorplan.CopyAction, localFile string) error {
+			action := byAction[a]
+			attempted[action] = true
+			if progress != nil {
+				progress.Copying(action)
+			} else if *verboseFlag {
+				if action.Dir == vendorDir {
+					fmt.Fprintf(stdout, "vendoring %s\n", action.Destination)
+				} else {
+					fmt.Fprintf(stdout, "vendoring %s into %s\n", action.Destination, action.Dir)
+				}
+			}
+			if err := rollback.Prepare(rollbackPath(action.Dir, vendorDir, action.Destination), localFile); err != nil {
+				return errors.New(fileError(action.mod, action.vendorFile, "backup", err))
+			}
+			return nil
+		},
+		Copy: func(a *vendorplan.CopyAction, localFile string) (n int64, err error) {
+			action := byAction[a]
+			if err := mkdirAll(filepath.Dir(localFile)); err != nil {
+				return 0, err
+			}
+			err = withRetry(func() (err error) {
+				n, err = copyModFile(action.mod, action.vendorFile, localFile)
+				return err
+			})
+			return n, err
+		},
+		Finish: func(a *vendorplan.CopyAction, localFile string, n int64) error {
+			action := byAction[a]
+			mod, vendorFile := action.mod, action.vendorFile
+			if owner != nil {
+				src := vendorFile
+				if mod.Zip != nil {
+					src = mod.Zip.Path
+				}
+				if err := owner.chown(localFile, src); err != nil {
+					return errors.New(fileError(mod, vendorFile, "set the owner of", err))
+				}
+			}
+			if *xattrsFlag && mod.Zip == nil {
+				if err := copyXattrs(longPath(vendorFile), longPath(localFile)); err != nil {
+					return errors.New(fileError(mod, vendorFile, "copy xattrs of", err))
+				}
+			}
+			files++
+			bytes += n
+			if progress != nil {
+				progress.Copied(action, n)
+			}
+			return nil
+		},
+		Failed: func(a *vendorplan.CopyAction, err error) {
+			action := byAction[a]
+			var fileErr *vendorplan.FileError
+			if errors.As(err, &fileErr) {
+				err = errors.New(fileError(action.mod, action.vendorFile, fileErr.Op, fileErr.Err))
+				if action.Dir == vendorDir {
+					delete(action.mod.VendorList, action.vendorFile)
+				}
+			}
+			fail(exitCopy, "Error! %s", err)
+		},
+		Stop: isInterrupted,
+	}
+	applier.Apply(planned)
+
+	// Files not copied when interrupted aren't vendored
+	if isInterrupted() {
+		for _, action := range actions {
+			if !attempted[action] && action.Dir == vendorDir {
+				delete(action.mod.VendorList, action.vendorFile)
+			}
+		}
+	}
+	if progress != nil {
+		progress.Done()
+	}
+	return files, bytes
+}
+
+// openModFile opens a file of the module, from the module dir or zip.
+func openModFile(mod *Mod, vendorFile string) (io.ReadCloser, os.FileInfo, error) {
+	if mod.Zip != nil {
+		relPath, _ := modRelPath(mod, vendorFile)
+		return mod.Zip.Open(relPath)
+	}
+	f, err := os.Open(longPath(vendorFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+func statModFile(mod *Mod, vendorFile string) (os.FileInfo, error) {
+	if mod.Zip != nil {
+		relPath, _ := modRelPath(mod, vendorFile)
+		return mod.Zip.Stat(relPath)
+	}
+	return os.Stat(longPath(vendorFile))
+}
+
+// sortActions orders actions by destination dir and path.
+func sortActions(actions []*CopyAction) {
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].Dir != actions[j].Dir {
+			return actions[i].Dir < actions[j].Dir
+		}
+		return actions[i].Destination < actions[j].Destination
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+var atExit []func()
+
+// exitCode is the code the run exits with, for the atExit funcs.
+var exitCode int
+
+// exit runs the registered atExit funcs, ie. to flush profiles, before
+// exiting with the given code.
+func exit(code int) {
+	exitCode = code
+	runAtExit()
+	os.Exit(code)
+}
+
+func runAtExit() {
+	for i := len(atExit) - 1; i >= 0; i-- {
+		atExit[i]()
+	}
+	atExit = nil
+}
+
+// startProfiling starts the cpu profile and execution trace, and registers
+// the writing of the memory profile at exit, as requested by flags.
+func startProfiling() error {
+	if *cpuProfileFlag != "" {
+		f, err := os.Create(*cpuProfileFlag)
+		if err != nil {
+			return fmt.Errorf("cpu profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("cpu profile: %v", err)
+		}
+		atExit = append(atExit, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+
+	if *traceFlag != "" {
+		f, err := os.Create(*traceFlag)
+		if err != nil {
+			return fmt.Errorf("trace: %v", err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return fmt.Errorf("trace: %v", err)
+		}
+		atExit = append(atExit, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+
+	if *memProfileFlag != "" {
+		path := *memProfileFlag
+		atExit = append(atExit, func() {
+			f, err := os.Create(path)
+			if err != nil {
+				fmt.Fprintf(stdout, "Error! %s - unable to write memory profile\n", err.Error())
+				return
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fmt.Fprintf(stdout, "Error! %s - unable to write memory profile\n", err.Error())
+			}
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// staleFiles returns the vendor relative paths of the files recorded in the
+// previous manifest which aren't vendored anymore.
+func staleFiles(prev, cur *Manifest) []string {
+	current := map[string]bool{}
+	for _, mm := range cur.Modules {
+		for file := range mm.Files {
+			current[file] = true
+		}
+	}
+	stale := []string{}
+	for _, mm := range prev.Modules {
+		for file := range mm.Files {
+			if !current[file] {
+				stale = append(stale, file)
+			}
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// goModVendored reports whether the vendor relative file is one go mod vendor
+// writes, a non-test .go file of a listed package. Those are left alone by
+// -prune when a -copy pattern stops matching them.
+func goModVendored(modules []*Mod, file string) bool {
+	if !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") {
+		return false
+	}
+	dir := path.Dir(file)
+	for _, mod := range modules {
+		for _, pkg := range mod.Pkgs {
+			if pkg == dir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keepFile is written into empty directories with -keep-files, so git tracks
+// them.
+const keepFile = ".keep"
+
+// pruneEmptyDirs removes the directories under dir which are empty, or only
+// contain empty directories, leaving dir itself and the keep dirs in place.
+// Directories only containing a keepFile count as empty.
+func pruneEmptyDirs(dir string, keep map[string]bool) ([]string, error) {
+	pruned := []string{}
+	var prune func(d string) (bool, error)
+	prune = func(d string) (bool, error) {
+		entries, err := ioutil.ReadDir(longPath(d))
+		if err != nil {
+			return false, err
+		}
+		empty := true
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				if entry.Name() != keepFile || d == dir || keep[d] {
+					empty = false
+				}
+				continue
+			}
+			sub := filepath.Join(d, entry.Name())
+			subEmpty, err := prune(sub)
+			if err != nil {
+				return false, err
+			}
+			if !subEmpty || keep[sub] {
+				empty = false
+				continue
+			}
+			os.Remove(longPath(filepath.Join(sub, keepFile)))
+			if err := os.Remove(longPath(sub)); err != nil {
+				return false, err
+			}
+			pruned = append(pruned, sub)
+		}
+		return empty, nil
+	}
+	_, err := prune(dir)
+	return pruned, err
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// remoteCache stores bundles of vendored files in object storage, ie.
+// s3://bucket/prefix or gs://bucket/prefix, or in a (shared) directory,
+// named by the digest of the run inputs. Object storage is accessed with the
+// aws and gcloud commands, using their configured credentials.
+type remoteCache string
+
+func (c remoteCache) object(key string) string {
+	return strings.TrimRight(string(c), "/") + "/" + key + ".tar.gz"
+}
+
+// copyCmd returns the command copying src to dst, either of which is in the
+// remote cache, or nil if it's a directory.
+func (c remoteCache) copyCmd(src, dst string) *exec.Cmd {
+	switch {
+	case strings.HasPrefix(string(c), "s3://"):
+		return exec.Command("aws", "s3", "cp", "--only-show-errors", src, dst)
+	case strings.HasPrefix(string(c), "gs://"):
+		return exec.Command("gcloud", "storage", "cp", "--quiet", src, dst)
+	}
+	return nil
+}
+
+func (c remoteCache) dir() string {
+	return strings.TrimPrefix(string(c), "file://")
+}
+
+// get downloads the bundle of the key to the local file.
+func (c remoteCache) get(key, file string) error {
+	src := c.object(key)
+	cmd := c.copyCmd(src, file)
+	if cmd == nil {
+		src = filepath.Join(c.dir(), key+".tar.gz")
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, data, 0644)
+	}
+	return runCopyCmd(cmd)
+}
+
+// put uploads the local file as the bundle of the key.
+func (c remoteCache) put(key, file string) error {
+	cmd := c.copyCmd(file, c.object(key))
+	if cmd == nil {
+		if err := os.MkdirAll(c.dir(), 0755); err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		// Written under a temporary name, so concurrent pulls never see a partial bundle
+		tmp, err := ioutil.TempFile(c.dir(), ".tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		// Temporary files are created 0600
+		if err = tmp.Chmod(0644); err == nil {
+			_, err = tmp.Write(data)
+		}
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), filepath.Join(c.dir(), key+".tar.gz"))
+	}
+	return runCopyCmd(cmd)
+}
+
+func runCopyCmd(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %v: %s", strings.Join(cmd.Args[:3], " "), err, msg)
+		}
+		return fmt.Errorf("%s: %v", strings.Join(cmd.Args[:3], " "), err)
+	}
+	return nil
+}
+
+// pullBundle restores the vendored files of the key from the remote cache
+// into the project dir, only accepting files below the roots.
+func pullBundle(c remoteCache, key string, roots []string) ([]string, error) {
+	tmp, err := ioutil.TempFile("", "modvendor-bundle")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := c.get(key, tmp.Name()); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return extractBundle(f, ".", roots)
+}
+
+// pushBundle uploads the vendored files, relative to the project dir, as
+// the bundle of the key.
+func pushBundle(c remoteCache, key string, files []string) error {
+	tmp, err := ioutil.TempFile("", "modvendor-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = writeBundle(tmp, files)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return c.put(key, tmp.Name())
+}
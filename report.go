@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+type moduleSize struct {
+	Module string
+	Files  int
+	Bytes  uint64
+}
+
+// moduleSizes sums the size and count of the files copied per module, largest
+// first.
+func moduleSizes(actions []*CopyAction) []moduleSize {
+	byModule := map[string]*moduleSize{}
+	for _, action := range actions {
+		if !action.mod.VendorList[action.vendorFile] {
+			continue // failed or interrupted
+		}
+		ms, ok := byModule[action.Module]
+		if !ok {
+			ms = &moduleSize{Module: action.Module}
+			byModule[action.Module] = ms
+		}
+		ms.Files++
+		ms.Bytes += uint64(action.Size)
+	}
+
+	sizes := []moduleSize{}
+	for _, ms := range byModule {
+		sizes = append(sizes, *ms)
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Bytes != sizes[j].Bytes {
+			return sizes[i].Bytes > sizes[j].Bytes
+		}
+		return sizes[i].Module < sizes[j].Module
+	})
+	return sizes
+}
+
+// printSizeReport prints the top n modules by vendored size, for -size-report.
+func printSizeReport(w io.Writer, actions []*CopyAction, n int) {
+	sizes := moduleSizes(actions)
+	if len(sizes) > n {
+		sizes = sizes[:n]
+	}
+	fmt.Fprintf(w, "Top %d modules by vendored size:\n", len(sizes))
+	for _, ms := range sizes {
+		fmt.Fprintf(w, "  %10s  %6d files  %s\n", formatBytes(ms.Bytes), ms.Files, ms.Module)
+	}
+}
+
+// duplicateSet is a set of vendored files with identical contents.
+type duplicateSet struct {
+	SHA256 string
+	Files  []string // vendor/ relative paths, sorted
+	Size   int64
+}
+
+// findDuplicates returns the sets of files in the manifest with identical
+// contents across modules, the most redundant bytes first.
+func findDuplicates(manifest *Manifest, actions []*CopyAction) []duplicateSet {
+	sizes := map[string]int64{}
+	for _, action := range actions {
+		sizes[nfc(action.Destination)] = action.Size
+	}
+
+	byHash := map[string][]string{}
+	modulesByHash := map[string]map[string]bool{}
+	for _, mm := range manifest.Modules {
+		for file, sum := range mm.Files {
+			byHash[sum] = append(byHash[sum], file)
+			if modulesByHash[sum] == nil {
+				modulesByHash[sum] = map[string]bool{}
+			}
+			modulesByHash[sum][mm.ImportPath] = true
+		}
+	}
+
+	sets := []duplicateSet{}
+	for sum, files := range byHash {
+		if len(modulesByHash[sum]) < 2 {
+			continue
+		}
+		sort.Strings(files)
+		sets = append(sets, duplicateSet{SHA256: sum, Files: files, Size: sizes[files[0]]})
+	}
+	redundant := func(set duplicateSet) int64 { return set.Size * int64(len(set.Files)-1) }
+	sort.Slice(sets, func(i, j int) bool {
+		if redundant(sets[i]) != redundant(sets[j]) {
+			return redundant(sets[i]) > redundant(sets[j])
+		}
+		return sets[i].Files[0] < sets[j].Files[0]
+	})
+	return sets
+}
+
+// printDuplicates prints the duplicate content report, for -duplicates.
+func printDuplicates(w io.Writer, sets []duplicateSet) {
+	var total int64
+	for _, set := range sets {
+		total += set.Size * int64(len(set.Files)-1)
+	}
+	fmt.Fprintf(w, "%d sets of files with identical contents across modules, %s redundant:\n", len(sets), formatBytes(uint64(total)))
+	for _, set := range sets {
+		fmt.Fprintf(w, "  %d copies of %s (%s):\n", len(set.Files), set.SHA256[:12], formatBytes(uint64(set.Size)))
+		for _, file := range set.Files {
+			fmt.Fprintf(w, "    %s\n", file)
+		}
+	}
+}
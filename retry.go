@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// Copies failing with transient errors are retried with exponential backoff,
+// ie. 50ms, 100ms, 200ms, 400ms and 800ms.
+const (
+	retryAttempts = 6
+	retryBackoff  = 50 * time.Millisecond
+)
+
+// withRetry runs fn until it succeeds, fails with a non-transient error or
+// runs out of attempts.
+func withRetry(fn func() error) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == retryAttempts || !isTransient(err) {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether err is a sharing violation or busy style error,
+// as caused by antivirus scanners on Windows or on NFS, or hitting the open
+// file limit, which may succeed if retried.
+func isTransient(err error) bool {
+	if tooManyOpenFiles(err) {
+		return true
+	}
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	for _, e := range transientErrnos {
+		if errno == e {
+			return true
+		}
+	}
+	return false
+}
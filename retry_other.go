@@ -0,0 +1,8 @@
+//go:build !windows && !linux && !darwin && !freebsd && !openbsd && !netbsd
+// +build !windows,!linux,!darwin,!freebsd,!openbsd,!netbsd
+
+package main
+
+import "syscall"
+
+var transientErrnos = []syscall.Errno{}
@@ -0,0 +1,13 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd
+// +build linux darwin freebsd openbsd netbsd
+
+package main
+
+import "syscall"
+
+var transientErrnos = []syscall.Errno{
+	syscall.EBUSY,
+	syscall.ETXTBSY,
+	syscall.EAGAIN,
+	syscall.EINTR,
+}
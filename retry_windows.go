@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+var transientErrnos = []syscall.Errno{
+	32,  // ERROR_SHARING_VIOLATION
+	33,  // ERROR_LOCK_VIOLATION
+	170, // ERROR_BUSY
+}
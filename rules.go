@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Actions of -rules
+const (
+	ruleAllow = "allow" // vendor the file, skipping later rules
+	ruleDeny  = "deny"  // don't vendor the file, with a warning
+	ruleWarn  = "warn"  // vendor the file, with a warning
+)
+
+// policyRule is a line of a -rules file, ie. "deny binary=true size>1MB",
+// applying its action to files matching all its conditions.
+type policyRule struct {
+	Action string
+	Conds  []ruleCond
+	Source string // file:line and text, for messages
+}
+
+// ruleCond compares an attribute of a file to a value:
+//
+//	module   module path, glob matching by path prefix as with -module-list
+//	path     ./vendor/ relative path, in .modvendorignore syntax
+//	ext      file extension, case insensitive, ie. .png
+//	size     file size, in bytes or with a KB, MB or GB suffix
+//	license  SPDX license of the module, unknown if undetected
+//	binary   true or false, as detected by git's heuristic
+//
+// All attributes can be compared with = and !=, sizes also with <, <=, >
+// and >=.
+type ruleCond struct {
+	Key, Op, Value string
+
+	size     int64
+	pathRule ignoreRule
+}
+
+type policyRules []*policyRule
+
+var ruleOps = []string{"<=", ">=", "!=", "=", "<", ">"}
+
+func parsePolicyRules(filePath string) (policyRules, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules := policyRules{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rule := &policyRule{Action: fields[0], Source: fmt.Sprintf("%s:%d %s", filePath, n, strings.Join(fields, " "))}
+		switch rule.Action {
+		case ruleAllow, ruleDeny, ruleWarn:
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown action %q, expected allow, deny or warn", filePath, n, rule.Action)
+		}
+		for _, field := range fields[1:] {
+			cond, err := parseRuleCond(field)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", filePath, n, err)
+			}
+			rule.Conds = append(rule.Conds, cond)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func parseRuleCond(field string) (ruleCond, error) {
+	i := strings.IndexAny(field, "=!<>")
+	if i <= 0 {
+		return ruleCond{}, fmt.Errorf("invalid condition %q, expected ie. ext=.png or size>1MB", field)
+	}
+	cond := ruleCond{Key: field[:i]}
+	for _, op := range ruleOps {
+		if strings.HasPrefix(field[i:], op) {
+			cond.Op, cond.Value = op, field[i+len(op):]
+			break
+		}
+	}
+	switch cond.Key {
+	case "size":
+		size, err := parseSize(cond.Value)
+		if err != nil {
+			return cond, err
+		}
+		cond.size = size
+		return cond, nil
+	case "module":
+		if _, err := path.Match(cond.Value, ""); err != nil {
+			return cond, fmt.Errorf("invalid module pattern %s: %v", cond.Value, err)
+		}
+	case "path":
+		rule, err := parseIgnoreRule(cond.Value)
+		if err != nil {
+			return cond, fmt.Errorf("invalid path pattern %s: %v", cond.Value, err)
+		}
+		cond.pathRule = rule
+	case "binary":
+		if cond.Value != "true" && cond.Value != "false" {
+			return cond, fmt.Errorf("invalid condition %q, binary is true or false", field)
+		}
+	case "ext", "license":
+	default:
+		return cond, fmt.Errorf("unknown attribute %q, expected module, path, ext, size, license or binary", cond.Key)
+	}
+	if cond.Op != "=" && cond.Op != "!=" {
+		return cond, fmt.Errorf("invalid condition %q, %s can only be compared with = and !=", field, cond.Key)
+	}
+	return cond, nil
+}
+
+// parseSize parses a size in bytes, or with a KB, MB or GB suffix.
+func parseSize(s string) (int64, error) {
+	upper := strings.ToUpper(s)
+	mult := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper, mult = strings.TrimSuffix(upper, unit.suffix), unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected ie. 512KB or 1MB", s)
+	}
+	return n * mult, nil
+}
+
+// ruleFile is the file a rule is evaluated over. Its license and binary-ness
+// are only looked up if a rule asks for them.
+type ruleFile struct {
+	action  *CopyAction
+	license func() string
+	binary  *bool
+}
+
+func (f *ruleFile) isBinary() bool {
+	if f.binary == nil {
+		b := isBinary(f.action)
+		f.binary = &b
+	}
+	return *f.binary
+}
+
+func (c ruleCond) match(f *ruleFile) bool {
+	if c.Key == "size" {
+		size := f.action.Size
+		switch c.Op {
+		case "<":
+			return size < c.size
+		case "<=":
+			return size <= c.size
+		case ">":
+			return size > c.size
+		case ">=":
+			return size >= c.size
+		case "!=":
+			return size != c.size
+		}
+		return size == c.size
+	}
+	eq := false
+	switch c.Key {
+	case "module":
+		eq = matchPathPrefix(c.Value, f.action.mod.ImportPath)
+	case "path":
+		eq = ignoreRules{c.pathRule}.ignored(f.action.Destination)
+	case "ext":
+		want := c.Value
+		if want != "" && !strings.HasPrefix(want, ".") {
+			want = "." + want
+		}
+		eq = strings.EqualFold(path.Ext(f.action.Destination), want)
+	case "license":
+		eq = f.license() == c.Value
+	case "binary":
+		eq = f.isBinary() == (c.Value == "true")
+	}
+	return eq == (c.Op == "=")
+}
+
+// eval returns the first rule matching the file, or nil.
+func (rules policyRules) eval(f *ruleFile) *policyRule {
+	for _, rule := range rules {
+		matched := true
+		for _, cond := range rule.Conds {
+			if !cond.match(f) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// parseTestPolicyRules parses a -rules file with the given contents.
+func parseTestPolicyRules(t *testing.T, rules string) (policyRules, error) {
+	t.Helper()
+	rulesPath := filepath.Join(t.TempDir(), "rules")
+	if err := ioutil.WriteFile(rulesPath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return parsePolicyRules(rulesPath)
+}
+
+func TestParsePolicyRules(t *testing.T) {
+	rules, err := parseTestPolicyRules(t, `# vendoring policy
+allow module=github.com/acme/*   path=include/**
+
+deny  binary=true size>=1MB # no big blobs
+warn  license!=MIT ext=.PNG
+deny
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		action, conds, source string
+	}{
+		{ruleAllow, "module=github.com/acme/* path=include/**", ":2 allow module=github.com/acme/* path=include/**"},
+		{ruleDeny, "binary=true size>=1048576", ":4 deny binary=true size>=1MB"},
+		{ruleWarn, "license!=MIT ext=.PNG", ":5 warn license!=MIT ext=.PNG"},
+		{ruleDeny, "", ":6 deny"},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i, w := range want {
+		conds := []string{}
+		for _, c := range rules[i].Conds {
+			value := c.Value
+			if c.Key == "size" {
+				value = strconv.FormatInt(c.size, 10)
+			}
+			conds = append(conds, c.Key+c.Op+value)
+		}
+		if rules[i].Action != w.action || strings.Join(conds, " ") != w.conds || !strings.HasSuffix(rules[i].Source, w.source) {
+			t.Errorf("rule %d = %s %v (%s), want %s %s (%s)", i, rules[i].Action, conds, rules[i].Source, w.action, w.conds, w.source)
+		}
+	}
+}
+
+func TestParsePolicyRulesErrors(t *testing.T) {
+	for _, test := range []struct {
+		line, err string
+	}{
+		{"block ext=.png", `unknown action "block"`},
+		{"deny ext", `invalid condition "ext"`},
+		{"deny =.png", `invalid condition "=.png"`},
+		{"deny color=red", `unknown attribute "color"`},
+		{"deny ext>.png", "ext can only be compared with = and !="},
+		{"deny license<MIT", "license can only be compared with = and !="},
+		{"deny binary=maybe", "binary is true or false"},
+		{"deny size>big", `invalid size "big"`},
+		{"deny size>-1KB", `invalid size "-1KB"`},
+		{"deny module=[", "invalid module pattern"},
+		{"deny path=[z-a]", "invalid path pattern"},
+	} {
+		_, err := parseTestPolicyRules(t, "allow ext=.h\n"+test.line+"\n")
+		if err == nil || !strings.Contains(err.Error(), ":2: ") || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q on line 2", test.line, err, test.err)
+		}
+	}
+}
+
+func TestPolicyRulesEval(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "include/x.h", "docs/logo.png")
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib.a"), []byte("!<arch>\n\x00\x01"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mod := &Mod{ModuleInfo: vendorplan.ModuleInfo{ImportPath: "github.com/acme/foo", Dir: dir}}
+
+	rules, err := parseTestPolicyRules(t, `allow path=**/include/**
+deny binary=true
+warn ext=png size<1KB
+deny license=unknown size>2MB
+warn license=unknown
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		relPath  string
+		size     int64
+		license  string
+		want     string // matching rule, by line
+		detected bool   // whether the license is looked up
+	}{
+		{"include/x.h", 1 << 30, licenseUnknown, ":1 ", false},
+		{"lib.a", 10, "MIT", ":2 ", false},
+		{"docs/logo.png", 13, "MIT", ":3 ", false},
+		{"docs/logo.png", 1 << 10, "MIT", "", true},
+		{"docs/logo.png", 3 << 20, licenseUnknown, ":4 ", true},
+		{"docs/logo.png", 1 << 20, licenseUnknown, ":5 ", true},
+	} {
+		detected := false
+		action := &CopyAction{
+			CopyAction: vendorplan.CopyAction{Destination: "github.com/acme/foo/" + test.relPath, Size: test.size},
+			mod:        mod,
+			vendorFile: filepath.Join(dir, filepath.FromSlash(test.relPath)),
+		}
+		f := &ruleFile{action: action, license: func() string {
+			detected = true
+			return test.license
+		}}
+		rule := rules.eval(f)
+		got := ""
+		if rule != nil {
+			got = rule.Source
+		}
+		if (test.want == "" && rule != nil) || !strings.Contains(got, test.want) {
+			t.Errorf("%s (%d bytes, %s): got rule %q, want %q", test.relPath, test.size, test.license, got, test.want)
+		}
+		// The license is only looked up by rules asking for it
+		if detected != test.detected {
+			t.Errorf("%s (%d bytes): got license looked up %v, want %v", test.relPath, test.size, detected, test.detected)
+		}
+	}
+}
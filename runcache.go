@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runCachePath is where the stamp of the last successful run of the project
+// is kept in the cache dir, with -run-cache.
+func runCachePath(cacheDir, cwd, vendorDir string) string {
+	sum := sha256.Sum256([]byte(cwd + "\x00" + vendorDir))
+	return filepath.Join(cacheDir, "run", hex.EncodeToString(sum[:]))
+}
+
+// outputOnlyFlags don't change the vendored files, so aren't part of the
+// run digest.
+var outputOnlyFlags = map[string]bool{
+	"v": true, "color": true, "cache": true, "run-cache": true, "remote-cache": true, "jobs": true,
+	"progress": true, "progress-format": true, "cpuprofile": true, "memprofile": true, "trace": true,
+}
+
+// runDigest hashes the inputs of a run: the modvendor version, the command
+// and flags, GOFLAGS, the patterns from directives, and the contents of the given
+// files (ie. go.mod).
+func runDigest(command string, modCopyPat map[string][]string, files []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", versionString(), command)
+	flags.Visit(func(f *flag.Flag) {
+		if !outputOnlyFlags[f.Name] {
+			fmt.Fprintf(h, "-%s=%q\x00", f.Name, f.Value.String())
+		}
+	})
+	fmt.Fprintf(h, "GOFLAGS=%s\x00", os.Getenv("GOFLAGS"))
+	importPaths := []string{}
+	for importPath := range modCopyPat {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+	for _, importPath := range importPaths {
+		fmt.Fprintf(h, "%s %q\x00", importPath, modCopyPat[importPath])
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(h, "%s missing\x00", file)
+			continue
+		}
+		fmt.Fprintf(h, "%s %d\x00", file, len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// runStampKey is the digest recorded in the local stamp. As `go mod vendor`
+// rewrites modules.txt, its modification time is part of it, so the files
+// `go mod vendor` removed are copied again.
+func runStampKey(digest, modtxtPath string) string {
+	if info, err := os.Stat(modtxtPath); err == nil {
+		return fmt.Sprintf("%s %d", digest, info.ModTime().UnixNano())
+	}
+	return digest
+}
+
+// runCacheHit reports whether the stamp records a run with the same digest,
+// and all files it wrote are still there with the same size, returning those
+// files.
+func runCacheHit(stampPath, digest string) ([]string, bool) {
+	f, err := os.Open(stampPath)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != digest {
+		return nil, false
+	}
+	files := []string{}
+	for scanner.Scan() {
+		s := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(s) != 2 {
+			return nil, false
+		}
+		size, err := strconv.ParseInt(s[0], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		info, err := os.Stat(longPath(s[1]))
+		if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+			return nil, false
+		}
+		files = append(files, s[1])
+	}
+	return files, scanner.Err() == nil
+}
+
+// writeRunCache records a successful run with the files it wrote.
+func writeRunCache(stampPath, digest string, files []string) {
+	lines := []string{digest}
+	for _, file := range files {
+		info, err := os.Stat(longPath(file))
+		if err != nil {
+			// Better to run again next time than to skip a missing file
+			return
+		}
+		lines = append(lines, fmt.Sprintf("%d\t%s", info.Size(), file))
+	}
+	writeCacheFile(stampPath, lines)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// scanResult is the outcome of the -scan command for a flagged file.
+type scanResult struct {
+	Module      string `json:"module"`
+	Destination string `json:"destination"`
+	Output      string `json:"output"`
+}
+
+// scanFile pipes a planned file through the -scan command, with
+// MODVENDOR_MODULE and MODVENDOR_FILE set. It returns whether the command
+// flagged the file by exiting non-zero, along with its output.
+func scanFile(command string, action *CopyAction) (bool, string, error) {
+	rc, _, err := openModFile(action.mod, action.vendorFile)
+	if err != nil {
+		return false, "", err
+	}
+	defer rc.Close()
+
+	var out bytes.Buffer
+	cmd := shellCommand(command)
+	cmd.Stdin = rc
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.Env = append(os.Environ(), "MODVENDOR_MODULE="+action.Module, "MODVENDOR_FILE="+action.Destination)
+	err = cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return true, string(bytes.TrimSpace(out.Bytes())), nil
+	} else if err != nil {
+		return false, "", fmt.Errorf("scan %q: %v", command, err)
+	}
+	return false, "", nil
+}
+
+func printScanSummary(w io.Writer, scanned int, flagged []scanResult) {
+	fmt.Fprintf(w, "Scanned %d files, %d flagged\n", scanned, len(flagged))
+	for _, r := range flagged {
+		fmt.Fprintf(w, "  %s (%s): %s\n", r.Destination, r.Module, r.Output)
+	}
+}
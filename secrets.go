@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"regexp"
+)
+
+// Secret policies, for -secrets.
+const (
+	secretWarn = "warn" // vendor files anyway, with a warning
+	secretSkip = "skip" // don't vendor files containing secrets, with a warning
+	secretFail = "fail" // fail the run
+)
+
+// secretRules match obvious secrets, as shipped by upstream modules as test
+// fixtures, which would trip repository secret scanners once vendored.
+var secretRules = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"private key", regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|ENCRYPTED|PGP) )?PRIVATE KEY( BLOCK)?-----`)},
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+}
+
+// Only the first MB of each file is scanned for secrets
+const secretScanLimit = 1 << 20
+
+// scanSecrets returns the kind of the first secret found in the planned
+// file, or "" if there's none.
+func scanSecrets(action *CopyAction) (string, error) {
+	rc, _, err := openModFile(action.mod, action.vendorFile)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(rc, secretScanLimit))
+	if err != nil {
+		return "", err
+	}
+	for _, rule := range secretRules {
+		if rule.re.Match(data) {
+			return rule.kind, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultReleaseURL is the GitHub API endpoint of the latest modvendor
+// release, which can be pointed at a mirror with -release-url.
+const defaultReleaseURL = "https://api.github.com/repos/goware/modvendor/releases/latest"
+
+// release is the subset of the GitHub releases API response we use.
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+func httpGet(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// selfUpdate replaces the running binary with the one for this platform from
+// the latest release, ie. the modvendor_linux_amd64 asset, after checking it
+// against the release's checksums.txt asset in sha256sum format. Older
+// releases than the running version are refused, unless allowDowngrade. It
+// returns the release version, and whether the binary was updated.
+func selfUpdate(releaseURL string, allowDowngrade bool) (string, bool, error) {
+	data, err := httpGet(releaseURL)
+	if err != nil {
+		return "", false, err
+	}
+	rel := release{}
+	if err := json.Unmarshal(data, &rel); err != nil {
+		return "", false, fmt.Errorf("invalid release from %s: %v", releaseURL, err)
+	}
+	if _, ok := parseSemver(rel.TagName); !ok {
+		return "", false, fmt.Errorf("release tag %q of %s isn't a semantic version", rel.TagName, releaseURL)
+	}
+	// Development builds can't be compared, and are always updated
+	current := moduleVersion()
+	if c, ok := compareSemver(current, rel.TagName); ok {
+		if c == 0 {
+			return rel.TagName, false, nil
+		}
+		if c > 0 && !allowDowngrade {
+			return "", false, fmt.Errorf("release %s is older than modvendor %s, pass -allow-downgrade to install it anyway", rel.TagName, current)
+		}
+	}
+
+	binName := "modvendor_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	var binURL, sumsURL string
+	for _, asset := range rel.Assets {
+		switch asset.Name {
+		case binName:
+			binURL = asset.URL
+		case "checksums.txt":
+			sumsURL = asset.URL
+		}
+	}
+	if binURL == "" {
+		return "", false, fmt.Errorf("release %s has no %s binary", rel.TagName, binName)
+	}
+	if sumsURL == "" {
+		return "", false, fmt.Errorf("release %s has no checksums.txt to verify %s against", rel.TagName, binName)
+	}
+
+	sums, err := httpGet(sumsURL)
+	if err != nil {
+		return "", false, err
+	}
+	want := ""
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		if s := strings.Fields(scanner.Text()); len(s) == 2 && strings.TrimPrefix(s[1], "*") == binName {
+			want = s[0]
+		}
+	}
+	if want == "" {
+		return "", false, fmt.Errorf("checksums.txt of release %s has no entry for %s", rel.TagName, binName)
+	}
+	bin, err := httpGet(binURL)
+	if err != nil {
+		return "", false, err
+	}
+	sum := sha256.Sum256(bin)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return "", false, fmt.Errorf("%s of release %s has sha256 %s, expected %s", binName, rel.TagName, got, want)
+	}
+
+	if err := replaceExecutable(bytes.NewReader(bin)); err != nil {
+		return "", false, err
+	}
+	return rel.TagName, true, nil
+}
+
+// replaceExecutable atomically replaces the running binary. On windows, where
+// a running binary can't be overwritten but can be renamed, the previous one
+// is moved aside first.
+func replaceExecutable(r io.Reader) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), ".modvendor-update")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+// semver is a parsed semantic version, ie. v1.2.3-rc.1+build.
+type semver struct {
+	core [3]int64
+	pre  []string // dot separated prerelease identifiers, if any
+}
+
+// parseSemver parses a version as tagged by Go modules, with a leading v and
+// optional prerelease and build metadata, ie. v1.2.3-rc.1+incompatible.
+func parseSemver(v string) (semver, bool) {
+	sv := semver{}
+	if !strings.HasPrefix(v, "v") {
+		return sv, false
+	}
+	v = v[1:]
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		for _, id := range strings.Split(v[i+1:], ".") {
+			if id == "" {
+				return sv, false
+			}
+			sv.pre = append(sv.pre, id)
+		}
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return sv, false
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return sv, false
+		}
+		sv.core[i] = n
+	}
+	return sv, true
+}
+
+// compareSemver returns -1, 0 or 1 as a is older, equal to or newer than b by
+// semver precedence, or false if either isn't a semantic version.
+func compareSemver(a, b string) (int, bool) {
+	va, ok := parseSemver(a)
+	if !ok {
+		return 0, false
+	}
+	vb, ok := parseSemver(b)
+	if !ok {
+		return 0, false
+	}
+	for i := range va.core {
+		if va.core[i] != vb.core[i] {
+			return sign(va.core[i] - vb.core[i]), true
+		}
+	}
+	// Prereleases are older than the release
+	switch {
+	case len(va.pre) == 0 && len(vb.pre) == 0:
+		return 0, true
+	case len(va.pre) == 0:
+		return 1, true
+	case len(vb.pre) == 0:
+		return -1, true
+	}
+	for i := 0; i < len(va.pre) && i < len(vb.pre); i++ {
+		if c := comparePrerelease(va.pre[i], vb.pre[i]); c != 0 {
+			return c, true
+		}
+	}
+	return sign(int64(len(va.pre) - len(vb.pre))), true
+}
+
+// comparePrerelease compares prerelease identifiers, numeric ones
+// numerically and before alphanumeric ones, which compare as strings.
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		if na == nb {
+			return 0
+		}
+		if na < nb {
+			return -1
+		}
+		return 1
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func sign(n int64) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
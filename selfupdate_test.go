@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompareSemver(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"v1.2.3", "v1.2.4", -1, true},
+		{"v1.10.0", "v1.9.0", 1, true},
+		{"v2.0.0", "v1.99.99", 1, true},
+		{"v1.2.3+build.1", "v1.2.3", 0, true},
+		{"v1.2.3-rc.1", "v1.2.3", -1, true},
+		{"v1.2.3-rc.2", "v1.2.3-rc.10", -1, true},
+		{"v1.2.3-rc.1", "v1.2.3-beta.2", 1, true},
+		{"v1.2.3-1", "v1.2.3-alpha", -1, true},
+		{"v1.2.3-alpha", "v1.2.3-alpha.1", -1, true},
+		{"v0.0.0-20200102150405-1a2b3c4d5e6f", "v0.1.0", -1, true},
+		{"(devel)", "v1.2.3", 0, false},
+		{"v1.2", "v1.2.3", 0, false},
+		{"1.2.3", "v1.2.3", 0, false},
+		{"v1.02.3", "v1.2.3", 0, false},
+		{"v1.2.3-", "v1.2.3", 0, false},
+	} {
+		got, ok := compareSemver(test.a, test.b)
+		if got != test.want || ok != test.ok {
+			t.Errorf("compareSemver(%s, %s) = %d, %v, want %d, %v", test.a, test.b, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestSelfUpdateVersions(t *testing.T) {
+	tag := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name":"` + tag + `","assets":[]}`))
+	}))
+	defer srv.Close()
+	defer func(v string) { buildVersion = v }(buildVersion)
+	buildVersion = "v1.2.0"
+
+	for _, test := range []struct {
+		tag       string
+		downgrade bool
+		err       string
+	}{
+		{tag: "v1.2.0"},
+		{tag: "v1.1.0", err: "release v1.1.0 is older than modvendor v1.2.0, pass -allow-downgrade"},
+		{tag: "v1.2.0-rc.1", err: "is older than"},
+		{tag: "latest", err: `release tag "latest"`},
+		// Past the version check, the release has no binaries
+		{tag: "v1.1.0", downgrade: true, err: "release v1.1.0 has no modvendor_"},
+		{tag: "v1.3.0", err: "release v1.3.0 has no modvendor_"},
+	} {
+		tag = test.tag
+		version, updated, err := selfUpdate(srv.URL, test.downgrade)
+		if test.err == "" {
+			if err != nil || updated || version != test.tag {
+				t.Errorf("%s: got %s, %v, %v, want up to date", test.tag, version, updated, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s (downgrade %v): got error %v, want %q", test.tag, test.downgrade, err, test.err)
+		}
+	}
+
+	// Development builds can't tell, and update
+	buildVersion = ""
+	tag = "v0.1.0"
+	if _, _, err := selfUpdate(srv.URL, false); err == nil || !strings.Contains(err.Error(), "has no modvendor_") {
+		t.Errorf("got error %v for a development build, want it updated", err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type statCount struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (c *statCount) add(size int64) {
+	c.Files++
+	c.Bytes += size
+}
+
+// vendorStats is the composition of the vendor tree, as reported by
+// `modvendor stats`.
+type vendorStats struct {
+	Total       statCount             `json:"total"`
+	Go          statCount             `json:"go"`
+	NonGo       statCount             `json:"non_go"`
+	Assets      statCount             `json:"assets"` // files recorded in the -manifest
+	ByExtension map[string]*statCount `json:"by_extension"`
+	ByModule    map[string]*statCount `json:"by_module"`
+}
+
+// collectStats walks the vendor dir, attributing files to the modules of
+// modules.txt by their longest matching import path. The manifest, if any,
+// tells which files were vendored by modvendor.
+func collectStats(vendorDir string, modules []*Mod, manifest *Manifest) (*vendorStats, error) {
+	stats := &vendorStats{
+		ByExtension: map[string]*statCount{},
+		ByModule:    map[string]*statCount{},
+	}
+	assets := map[string]bool{}
+	if manifest != nil {
+		for _, mm := range manifest.Modules {
+			for file := range mm.Files {
+				assets[file] = true
+			}
+		}
+	}
+
+	err := filepath.Walk(vendorDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(vendorDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "modules.txt" {
+			return nil
+		}
+
+		size := info.Size()
+		stats.Total.add(size)
+		if strings.HasSuffix(rel, ".go") {
+			stats.Go.add(size)
+		} else {
+			stats.NonGo.add(size)
+		}
+		if assets[nfc(rel)] {
+			stats.Assets.add(size)
+		}
+
+		ext := path.Ext(rel)
+		if ext == "" {
+			ext = "(none)"
+		}
+		if stats.ByExtension[ext] == nil {
+			stats.ByExtension[ext] = &statCount{}
+		}
+		stats.ByExtension[ext].add(size)
+
+		module := ""
+		for _, mod := range modules {
+			if strings.HasPrefix(rel, mod.ImportPath+"/") && len(mod.ImportPath) > len(module) {
+				module = mod.ImportPath
+			}
+		}
+		if module == "" {
+			module = "(unknown)"
+		}
+		if stats.ByModule[module] == nil {
+			stats.ByModule[module] = &statCount{}
+		}
+		stats.ByModule[module].add(size)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func printStats(w io.Writer, stats *vendorStats, asJSON bool) {
+	if asJSON {
+		data, _ := json.MarshalIndent(stats, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return
+	}
+
+	line := func(name string, c statCount) {
+		fmt.Fprintf(w, "  %-40s %6d files %10s\n", name, c.Files, formatBytes(uint64(c.Bytes)))
+	}
+	fmt.Fprintln(w, "Total:")
+	line("all files", stats.Total)
+	line("Go", stats.Go)
+	line("non-Go", stats.NonGo)
+	line("vendored by modvendor", stats.Assets)
+
+	for _, group := range []struct {
+		title  string
+		counts map[string]*statCount
+	}{{"By extension:", stats.ByExtension}, {"By module:", stats.ByModule}} {
+		names := []string{}
+		for name := range group.counts {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := group.counts[names[i]], group.counts[names[j]]
+			if a.Bytes != b.Bytes {
+				return a.Bytes > b.Bytes
+			}
+			return names[i] < names[j]
+		})
+		fmt.Fprintln(w, group.title)
+		for _, name := range names {
+			line(name, *group.counts[name])
+		}
+	}
+}
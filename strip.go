@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// moduleFlag is a repeatable flag of <module>=<value> pairs.
+type moduleFlag map[string]string
+
+func (f moduleFlag) String() string {
+	pairs := []string{}
+	for mod, value := range f {
+		pairs = append(pairs, mod+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f moduleFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("expected <module>=<value>")
+	}
+	f[value[:i]] = value[i+1:]
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// syncVendor implements the first step of `modvendor sync`. It moves the
+// current vendor dir aside and regenerates it with `go mod vendor`, which also
+// drops any stale assets from a previous run. Unless the returned commit func
+// is called, the previous vendor dir is put back at exit, so sync either
+// completes or leaves the vendor dir untouched.
+func syncVendor(vendorDir string) (commit func(), err error) {
+	oldDir := vendorDir + ".modvendor-old"
+	if err := os.RemoveAll(oldDir); err != nil {
+		return nil, err
+	}
+	hadVendor := true
+	if err := os.Rename(vendorDir, oldDir); os.IsNotExist(err) {
+		hadVendor = false
+	} else if err != nil {
+		return nil, err
+	}
+
+	committed := false
+	restore := func() {
+		if committed {
+			return
+		}
+		if err := os.RemoveAll(vendorDir); err != nil {
+			fmt.Fprintf(stdout, "Error! %s - unable to restore %s to its previous state\n", err.Error(), vendorDir)
+			return
+		}
+		if hadVendor {
+			if err := os.Rename(oldDir, vendorDir); err != nil {
+				fmt.Fprintf(stdout, "Error! %s - unable to restore %s to its previous state\n", err.Error(), vendorDir)
+				return
+			}
+		}
+		fmt.Fprintf(stdout, "Restored %s to its previous state\n", vendorDir)
+	}
+
+	args := []string{"mod", "vendor"}
+	if vendorDir != "vendor" {
+		args = append(args, "-o", vendorDir)
+	}
+	if _, err := goCmd(args...); err != nil {
+		restore()
+		return nil, err
+	}
+	atExit = append(atExit, restore)
+
+	return func() {
+		committed = true
+		os.RemoveAll(oldDir)
+	}, nil
+}
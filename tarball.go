@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tarModTime is the modification time of all -tar entries: SOURCE_DATE_EPOCH
+// if set, as with reproducible builds, otherwise the unix epoch.
+func tarModTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0)
+	}
+	return time.Unix(0, 0)
+}
+
+// writeVendorTar writes the vendor dir as a tar (gzipped if the path ends in
+// .gz or .tgz) which only changes when the vendored contents do: entries are
+// sorted, owned by root and have fixed modification times, and modes are
+// normalized to 0644 or 0755.
+func writeVendorTar(vendorDir, tarPath string) error {
+	tarAbs, err := filepath.Abs(tarPath)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(tarAbs), ".modvendor-tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var w io.Writer = tmp
+	var zw *gzip.Writer
+	if strings.HasSuffix(tarPath, ".gz") || strings.HasSuffix(tarPath, ".tgz") {
+		zw = gzip.NewWriter(tmp)
+		w = zw
+	}
+	// Neither the tar nor its temporary file are part of it, if in the vendor dir
+	tmpAbs, _ := filepath.Abs(tmp.Name())
+	if err := writeTarEntries(w, vendorDir, map[string]bool{tarAbs: true, tmpAbs: true}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), tarAbs)
+}
+
+func writeTarEntries(w io.Writer, vendorDir string, skip map[string]bool) error {
+	// Entries are named as the vendor dir is, ie. vendor/github.com/foo/bar
+	prefix := filepath.ToSlash(filepath.Clean(vendorDir))
+	if filepath.IsAbs(vendorDir) {
+		prefix = filepath.Base(vendorDir)
+	}
+	modTime := tarModTime()
+	tw := tar.NewWriter(w)
+
+	// filepath.Walk visits files in lexical order, so entries are sorted
+	err := filepath.Walk(vendorDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if abs, err := filepath.Abs(p); err == nil && skip[abs] {
+			return nil
+		}
+		rel, err := filepath.Rel(vendorDir, p)
+		if err != nil {
+			return err
+		}
+		name := prefix
+		if rel != "." {
+			name += "/" + filepath.ToSlash(rel)
+		}
+		hdr := &tar.Header{
+			Name:    name,
+			ModTime: modTime,
+			Mode:    0644,
+		}
+		switch {
+		case info.IsDir():
+			hdr.Typeflag, hdr.Name, hdr.Mode = tar.TypeDir, name+"/", 0755
+		case info.Mode().IsRegular():
+			hdr.Typeflag, hdr.Size = tar.TypeReg, info.Size()
+			if info.Mode().Perm()&0111 != 0 {
+				hdr.Mode = 0755
+			}
+		default:
+			return fmt.Errorf("%s: %s can't be added to the tar", p, fileTypeName(info.Mode()))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := os.Open(longPath(p))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVendorTarDeterministic(t *testing.T) {
+	files := []string{"modules.txt", "github.com/a/b/include/x.h", "github.com/a/b/src/x.c", "github.com/c/d/d.h", "github.com/c/d/configure"}
+
+	// Two vendor dirs with the same contents, written in another order, with
+	// other modes and shuffled modification times
+	build := func(seed int64) []byte {
+		t.Helper()
+		r := rand.New(rand.NewSource(seed))
+		vendorDir := filepath.Join(t.TempDir(), "vendor")
+		order := append([]string{}, files...)
+		r.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		writeTree(t, vendorDir, order...)
+
+		err := filepath.Walk(vendorDir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				mode := os.FileMode(0644)
+				if r.Intn(2) == 0 {
+					mode = 0600
+				}
+				if strings.HasSuffix(p, "configure") {
+					mode |= 0100
+				}
+				if err := os.Chmod(p, mode); err != nil {
+					return err
+				}
+			}
+			mtime := time.Unix(r.Int63n(1<<31), 0)
+			return os.Chtimes(p, mtime, mtime)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tarPath := filepath.Join(t.TempDir(), "vendor.tar.gz")
+		if err := writeVendorTar(vendorDir, tarPath); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(tarPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first, second := build(1), build(2)
+	if !bytes.Equal(first, second) {
+		t.Fatal("the tars of the same contents differ")
+	}
+
+	// Entries are sorted, with normalized modes and times
+	zr, err := gzip.NewReader(bytes.NewReader(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	names := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		wantMode := int64(0644)
+		if hdr.Typeflag == tar.TypeDir || strings.HasSuffix(hdr.Name, "configure") {
+			wantMode = 0755
+		}
+		if hdr.Mode != wantMode || !hdr.ModTime.Equal(time.Unix(0, 0)) || hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Errorf("%s: got mode %o, time %v and owner %d:%d", hdr.Name, hdr.Mode, hdr.ModTime, hdr.Uid, hdr.Gid)
+		}
+	}
+	want := []string{
+		"vendor/",
+		"vendor/github.com/",
+		"vendor/github.com/a/",
+		"vendor/github.com/a/b/",
+		"vendor/github.com/a/b/include/",
+		"vendor/github.com/a/b/include/x.h",
+		"vendor/github.com/a/b/src/",
+		"vendor/github.com/a/b/src/x.c",
+		"vendor/github.com/c/",
+		"vendor/github.com/c/d/",
+		"vendor/github.com/c/d/configure",
+		"vendor/github.com/c/d/d.h",
+		"vendor/modules.txt",
+	}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("got entries %v, want %v", names, want)
+	}
+
+	// SOURCE_DATE_EPOCH changes the time of entries only
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	if third := build(3); bytes.Equal(first, third) {
+		t.Error("the tar ignores SOURCE_DATE_EPOCH")
+	} else if fourth := build(4); !bytes.Equal(third, fourth) {
+		t.Error("the tars of the same contents differ with SOURCE_DATE_EPOCH")
+	}
+}
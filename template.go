@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+)
+
+// runResult is the data -manifest-template is executed with.
+type runResult struct {
+	VendorDir string
+	Modules   []*ManifestModule // as in the -manifest file
+	Actions   []*CopyAction     // as printed by -plan
+	Changelog []string          // changes since the previous -manifest, if any
+	Failures  []string          // with -keep-going
+	Flagged   []scanResult      // files flagged by -scan
+	Skipped   []skippedFile     // matched files which aren't regular files
+	Warnings  []string          // warnings printed during the run, with -report
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return string(data), err
+	},
+}
+
+// renderTemplate executes the Go text/template file with the run result,
+// writing the output to outPath, or stdout if empty.
+func renderTemplate(tmplPath, outPath string, result *runResult) error {
+	tmpl, err := template.New(filepath.Base(tmplPath)).Funcs(templateFuncs).ParseFiles(tmplPath)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, result); err != nil {
+		return err
+	}
+	if outPath == "" {
+		_, err = stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(outPath, buf.Bytes(), 0644)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tracer records the spans of the run and exports them at exit to an OTLP
+// collector, as configured by the standard OTEL_EXPORTER_OTLP_* env vars.
+// There's no OpenTelemetry SDK dependency: spans are posted as OTLP/HTTP
+// JSON, which collectors accept on the same port as protobuf.
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	timeout  time.Duration
+	service  string
+
+	traceID  string
+	parentID string // from TRACEPARENT, ie. the CI job's span
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+// span is a timed phase of the run. All methods are no-ops on a nil span, so
+// callers don't need to check whether tracing is enabled.
+type span struct {
+	t        *tracer
+	id       string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	errMsg   string
+}
+
+// newTracer returns a tracer if an OTLP traces endpoint is configured, or
+// nil, along with a warning about settings which aren't supported.
+func newTracer() (*tracer, string) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" || os.Getenv("OTEL_SDK_DISABLED") == "true" || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return nil, ""
+	}
+	t := &tracer{
+		endpoint: endpoint,
+		headers:  map[string]string{},
+		timeout:  10 * time.Second,
+		service:  "modvendor",
+		traceID:  randomID(16),
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		t.service = name
+	}
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		for _, kv := range strings.Split(os.Getenv(name), ",") {
+			i := strings.Index(kv, "=")
+			if i <= 0 {
+				continue
+			}
+			value, err := url.QueryUnescape(strings.TrimSpace(kv[i+1:]))
+			if err != nil {
+				value = strings.TrimSpace(kv[i+1:])
+			}
+			t.headers[strings.TrimSpace(kv[:i])] = value
+		}
+	}
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_TIMEOUT", "OTEL_EXPORTER_OTLP_TRACES_TIMEOUT"} {
+		if ms, err := strconv.Atoi(os.Getenv(name)); err == nil && ms > 0 {
+			t.timeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+	// Continue the trace of the CI pipeline, if it passes one down
+	if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+		t.traceID, t.parentID = parts[1], parts[2]
+	}
+
+	warning := ""
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/json" {
+		warning = fmt.Sprintf("OTLP protocol %s is not supported, exporting traces as http/json", protocol)
+	}
+	return t, warning
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start starts a span, as a child of parent if not nil.
+func (t *tracer) start(parent *span, name string) *span {
+	if t == nil {
+		return nil
+	}
+	s := &span{t: t, id: randomID(8), parentID: t.parentID, name: name, start: time.Now(), attrs: map[string]interface{}{}}
+	if parent != nil {
+		s.parentID = parent.id
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+// child starts a span within s.
+func (s *span) child(name string) *span {
+	if s == nil {
+		return nil
+	}
+	return s.t.start(s, name)
+}
+
+func (s *span) setAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	s.attrs[key] = value
+	s.t.mu.Unlock()
+}
+
+func (s *span) setError(msg string) {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	s.errMsg = msg
+	s.t.mu.Unlock()
+}
+
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	s.t.mu.Unlock()
+}
+
+// OTLP/HTTP JSON encoding, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 is error
+	Message string `json:"message,omitempty"`
+}
+
+func otlpAttr(key string, value interface{}) otlpKeyValue {
+	switch v := value.(type) {
+	case int:
+		return otlpKeyValue{key, map[string]interface{}{"intValue": strconv.Itoa(v)}}
+	case int64:
+		return otlpKeyValue{key, map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}}
+	case bool:
+		return otlpKeyValue{key, map[string]interface{}{"boolValue": v}}
+	}
+	return otlpKeyValue{key, map[string]interface{}{"stringValue": fmt.Sprint(value)}}
+}
+
+// export posts the spans to the collector, ending any still open ones, ie.
+// when exiting early.
+func (t *tracer) export() error {
+	t.mu.Lock()
+	spans := []otlpSpan{}
+	for _, s := range t.spans {
+		if s.end.IsZero() {
+			s.end = time.Now()
+		}
+		out := otlpSpan{
+			TraceID:           t.traceID,
+			SpanID:            s.id,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              1, // internal
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		for _, key := range sortedKeys(s.attrs) {
+			out.Attributes = append(out.Attributes, otlpAttr(key, s.attrs[key]))
+		}
+		if s.errMsg != "" {
+			out.Status = &otlpStatus{Code: 2, Message: s.errMsg}
+		}
+		spans = append(spans, out)
+	}
+	t.mu.Unlock()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpKeyValue{otlpAttr("service.name", t.service), otlpAttr("service.version", versionString())},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "github.com/goware/modvendor"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := (&http.Client{Timeout: t.timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s %s", t.endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
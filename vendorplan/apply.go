@@ -0,0 +1,95 @@
+package vendorplan
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Applier executes copy actions, with hooks for custom executors. The zero
+// Applier copies the files with their source modes made owner-writable, and
+// stops at the first failure.
+type Applier struct {
+	// Prepare is called before copying the file of the action to dst, ie.
+	// to back up the file it replaces.
+	Prepare func(action *CopyAction, dst string) error
+
+	// Copy copies the file of the action to dst, creating its dir, instead
+	// of the default copy.
+	Copy func(action *CopyAction, dst string) (int64, error)
+
+	// Finish is called once the file of the action was copied to dst, ie.
+	// to set its owner.
+	Finish func(action *CopyAction, dst string, n int64) error
+
+	// Failed is called with the failure of each action, and the remaining
+	// actions are still applied. Copy failures are FileErrors, those of the
+	// other hooks are passed on as is.
+	Failed func(action *CopyAction, err error)
+
+	// Stop reports whether to stop before the next action, ie. when
+	// interrupted.
+	Stop func() bool
+}
+
+// Apply executes the copy actions with the zero Applier.
+func Apply(actions []*CopyAction) error {
+	return (&Applier{}).Apply(actions)
+}
+
+// Apply executes the copy actions, in order. Without a Failed hook, the
+// first failure is returned.
+func (ap *Applier) Apply(actions []*CopyAction) error {
+	for _, action := range actions {
+		if ap.Stop != nil && ap.Stop() {
+			break
+		}
+		if err := ap.apply(action); err != nil {
+			if ap.Failed == nil {
+				return err
+			}
+			ap.Failed(action, err)
+		}
+	}
+	return nil
+}
+
+func (ap *Applier) apply(action *CopyAction) error {
+	dst := filepath.Join(action.Dir, filepath.FromSlash(action.Destination))
+	if ap.Prepare != nil {
+		if err := ap.Prepare(action, dst); err != nil {
+			return err
+		}
+	}
+	copyFn := ap.Copy
+	if copyFn == nil {
+		copyFn = copyFile
+	}
+	n, err := copyFn(action, dst)
+	if err != nil {
+		return &FileError{Module: action.Module, File: action.file, Op: "copy", Err: err}
+	}
+	if ap.Finish != nil {
+		return ap.Finish(action, dst, n)
+	}
+	return nil
+}
+
+// copyFile is the default copy, of regular files only.
+func copyFile(action *CopyAction, dst string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	if action.source == nil {
+		return CopyFile(action.file.Path, dst, 0)
+	}
+	src, info, err := action.open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	if !info.Mode().IsRegular() {
+		return 0, errors.New("not a regular file")
+	}
+	return WriteFile(dst, src, info.Mode(), 0)
+}
@@ -0,0 +1,155 @@
+package vendorplan
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// copyBufPool holds buffers for copying file contents where the platform has
+// no fast path, as we copy a large number of mostly small files.
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 64*1024)
+		return &buf
+	},
+}
+
+// bufferedCopy copies src to dst using a pooled buffer. The reader and writer
+// are wrapped so io.CopyBuffer doesn't bypass the buffer via ReadFrom/WriteTo.
+func bufferedCopy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// sparseBlockSize is the granularity at which holes are preserved
+const sparseBlockSize = 4096
+
+// sparseCopy copies src to dst, seeking over blocks of zeros instead of
+// writing them so holes in sparse files are preserved.
+func sparseCopy(dst, src *os.File) (int64, error) {
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+
+	var written int64
+	for {
+		n, err := src.Read(*buf)
+		for off := 0; off < n; off += sparseBlockSize {
+			end := off + sparseBlockSize
+			if end > n {
+				end = n
+			}
+			block := (*buf)[off:end]
+			if isZeros(block) {
+				if _, err := dst.Seek(int64(len(block)), io.SeekCurrent); err != nil {
+					return written, err
+				}
+			} else if _, err := dst.Write(block); err != nil {
+				return written, err
+			}
+			written += int64(len(block))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+
+	// Extend the file if it ends with a hole
+	return written, dst.Truncate(written)
+}
+
+func isZeros(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateFile creates or truncates dst for copying a file with the source
+// mode into. Its mode is the given one if set, otherwise the source mode made
+// owner-writable. Files left read-only by a previous copy, ie. by tools
+// preserving the 0444 modes of the module cache, are replaced.
+func CreateFile(dst string, srcMode, mode os.FileMode) (*os.File, error) {
+	perm := mode
+	if perm == 0 {
+		perm = srcMode.Perm() | 0200
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if os.IsPermission(err) {
+		if rmErr := os.Remove(dst); rmErr == nil {
+			f, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The mode only applies to new files, and subject to the umask, so an
+	// explicit mode is set as is, and otherwise existing files are still
+	// made owner-writable
+	chmod := mode
+	if info, err := f.Stat(); chmod == 0 && err == nil && info.Mode().Perm()&0200 == 0 {
+		chmod = info.Mode().Perm() | 0200
+	}
+	if chmod != 0 {
+		if err := f.Chmod(chmod); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// CopyFile copies the regular file src to dst, created as by CreateFile.
+// Holes of sparse files are preserved, and other files are copied within the
+// kernel where supported.
+func CopyFile(src, dst string, mode os.FileMode) (int64, error) {
+	srcStat, err := os.Stat(src)
+	if err != nil {
+		return 0, err
+	}
+
+	if !srcStat.Mode().IsRegular() {
+		return 0, &os.PathError{Op: "copy", Path: src, Err: errors.New("not a regular file")}
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := CreateFile(dst, srcStat.Mode(), mode)
+	if err != nil {
+		return 0, err
+	}
+	defer dstFile.Close()
+
+	sparse, err := isSparse(srcFile, srcStat.Size())
+	if err != nil {
+		return 0, err
+	}
+	if sparse {
+		return sparseCopy(dstFile, srcFile)
+	}
+	return copyContents(dstFile, srcFile)
+}
+
+// WriteFile copies the contents of src, ie. a module zip entry, to dst,
+// created as by CreateFile.
+func WriteFile(dst string, src io.Reader, srcMode, mode os.FileMode) (int64, error) {
+	dstFile, err := CreateFile(dst, srcMode, mode)
+	if err != nil {
+		return 0, err
+	}
+	defer dstFile.Close()
+
+	return bufferedCopy(dstFile, src)
+}
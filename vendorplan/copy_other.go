@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package vendorplan
+
+import (
+	"os"
+)
+
+func copyContents(dst, src *os.File) (int64, error) {
+	return bufferedCopy(dst, src)
+}
@@ -0,0 +1,74 @@
+package vendorplan
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFileSparse(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "sparse")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("x"), sparseBlockSize)
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(data, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	// Ends with a hole too
+	if err := f.Truncate(2 << 20); err != nil {
+		t.Fatal(err)
+	}
+	sparse, err := isSparse(f, 2<<20)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "copy")
+	n, err := CopyFile(src, dst, 0)
+	if err != nil || n != 2<<20 {
+		t.Fatalf("copied %d bytes, %v, want %d", n, err, 2<<20)
+	}
+	want, _ := ioutil.ReadFile(src)
+	got, err := ioutil.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("got %d bytes, %v, want the same contents as the source", len(got), err)
+	}
+	if !sparse {
+		t.Skip("holes aren't reported on this filesystem")
+	}
+	f, err = os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if sparse, err := isSparse(f, 2<<20); err != nil || !sparse {
+		t.Errorf("got sparse %v, %v for the copy, want its holes preserved", sparse, err)
+	}
+
+	// Files without holes aren't sparse, and are read from their start after
+	// checking
+	dense := filepath.Join(dir, "dense")
+	if err := ioutil.WriteFile(dense, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err = os.Open(dense)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if sparse, err := isSparse(f, int64(len(data))); err != nil || sparse {
+		t.Errorf("got sparse %v, %v for a file without holes", sparse, err)
+	}
+	if b, err := ioutil.ReadAll(f); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("read %d bytes, %v after checking, want all of them", len(b), err)
+	}
+}
@@ -0,0 +1,180 @@
+package vendorplan
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// vendorFS is a read-only fs.FS over the planned vendor/ tree, ie. the files
+// modvendor would write, by their vendor relative paths. Contents are read
+// from the module Sources, so nothing has to be written to disk first.
+type vendorFS struct {
+	files map[string]vendorFSSource // vendor relative path -> module file
+	dirs  map[string][]string       // vendor relative dir -> sorted entry names
+}
+
+type vendorFSSource struct {
+	source Source
+	file   *File
+}
+
+// FS returns a read-only fs.FS over the planned vendor dir of the config,
+// with the files Plan plans into it by their destinations, ie. to hash or
+// check them before anything is written. Files planned into other dirs
+// aren't included, and of files with the same destination, the first is
+// used.
+func FS(cfg Config) (fs.FS, error) {
+	actions, err := Plan(cfg)
+	if err != nil {
+		return nil, err
+	}
+	fsys := &vendorFS{
+		files: map[string]vendorFSSource{},
+		dirs:  map[string][]string{".": nil},
+	}
+	for _, a := range actions {
+		if a.Dir != cfg.VendorDir {
+			continue
+		}
+		name := a.Destination
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("module %s: invalid destination %q of %s", a.Module, name, a.file.Path)
+		}
+		if _, ok := fsys.files[name]; ok {
+			continue
+		}
+		if _, ok := fsys.dirs[name]; ok {
+			return nil, fmt.Errorf("module %s: destination %s of %s is a dir", a.Module, name, a.file.Path)
+		}
+		fsys.files[name] = vendorFSSource{source: a.source, file: a.file}
+		for name != "." {
+			dir := path.Dir(name)
+			if _, ok := fsys.files[dir]; ok {
+				return nil, fmt.Errorf("module %s: destination %s of %s is below a file", a.Module, a.Destination, a.file.Path)
+			}
+			_, seen := fsys.dirs[dir]
+			fsys.dirs[dir] = append(fsys.dirs[dir], path.Base(name))
+			if seen {
+				break
+			}
+			name = dir
+		}
+	}
+	for _, entries := range fsys.dirs {
+		sort.Strings(entries)
+	}
+	return fsys, nil
+}
+
+func (fsys *vendorFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if src, ok := fsys.files[name]; ok {
+		rc, info, err := openFile(src.source, src.file.Path)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &vendorFSFile{ReadCloser: rc, info: namedFileInfo{info, path.Base(name)}}, nil
+	}
+	if _, ok := fsys.dirs[name]; ok {
+		return &vendorFSDir{fsys: fsys, name: name}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (fsys *vendorFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if src, ok := fsys.files[name]; ok {
+		info, err := statFile(src.source, src.file.Path)
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		return namedFileInfo{info, path.Base(name)}, nil
+	}
+	if _, ok := fsys.dirs[name]; ok {
+		return dirInfo(path.Base(name)), nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+type vendorFSFile struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (f *vendorFSFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+type vendorFSDir struct {
+	fsys   *vendorFS
+	name   string
+	offset int
+}
+
+func (d *vendorFSDir) Stat() (fs.FileInfo, error) { return dirInfo(path.Base(d.name)), nil }
+func (d *vendorFSDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+func (d *vendorFSDir) Close() error { return nil }
+
+func (d *vendorFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	names := d.fsys.dirs[d.name][d.offset:]
+	if n > 0 && len(names) > n {
+		names = names[:n]
+	}
+	if n > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	d.offset += len(names)
+
+	entries := make([]fs.DirEntry, len(names))
+	for i, name := range names {
+		p := path.Join(d.name, name)
+		_, isDir := d.fsys.dirs[p]
+		entries[i] = vendorFSDirEntry{fsys: d.fsys, path: p, isDir: isDir}
+	}
+	return entries, nil
+}
+
+type vendorFSDirEntry struct {
+	fsys  *vendorFS
+	path  string
+	isDir bool
+}
+
+func (e vendorFSDirEntry) Name() string { return path.Base(e.path) }
+func (e vendorFSDirEntry) IsDir() bool  { return e.isDir }
+func (e vendorFSDirEntry) Type() fs.FileMode {
+	if e.isDir {
+		return fs.ModeDir
+	}
+	return 0
+}
+func (e vendorFSDirEntry) Info() (fs.FileInfo, error) { return e.fsys.Stat(e.path) }
+
+// namedFileInfo reports a module file under its vendor path base name, which
+// differs from the source's with -case-collision=rename.
+type namedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fi namedFileInfo) Name() string { return fi.name }
+
+type dirInfo string
+
+func (di dirInfo) Name() string       { return string(di) }
+func (di dirInfo) Size() int64        { return 0 }
+func (di dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (di dirInfo) ModTime() time.Time { return time.Time{} }
+func (di dirInfo) IsDir() bool        { return true }
+func (di dirInfo) Sys() interface{}   { return nil }
+
+var _ fs.StatFS = (*vendorFS)(nil)
+var _ fs.ReadDirFile = (*vendorFSDir)(nil)
@@ -0,0 +1,189 @@
+package vendorplan
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ModuleInfo is a module as listed in vendor/modules.txt, with the packages
+// used of it.
+type ModuleInfo struct {
+	ImportPath    string
+	SourcePath    string // replacement module path or dir, if replaced
+	Version       string
+	SourceVersion string   // replacement version, if replaced by a module
+	Dir           string   // full path, ie. $GOPATH/pkg/mod/
+	Pkgs          []string // package import paths
+	Explicit      bool     // marked "## explicit", ie. a direct dependency
+}
+
+func (m *ModuleInfo) String() string {
+	s := fmt.Sprintf("%s@%s", m.ImportPath, m.Version)
+	if m.SourceVersion != "" {
+		s += fmt.Sprintf(" => %s@%s", m.SourcePath, m.SourceVersion)
+	} else if m.SourcePath != "" {
+		s += " => " + m.SourcePath
+	}
+	return s
+}
+
+// ParseModulesFile parses the modules and their packages from a
+// vendor/modules.txt file, as written by `go mod vendor`.
+func ParseModulesFile(modtxtPath string) ([]*ModuleInfo, error) {
+	f, err := os.Open(modtxtPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Split(bufio.ScanLines)
+
+	var mod *ModuleInfo
+	modules := []*ModuleInfo{}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		// Module annotations, ie. "## explicit" or "## explicit; go 1.17"
+		if strings.HasPrefix(line, "## ") {
+			for _, annotation := range strings.Split(line[3:], ";") {
+				if strings.TrimSpace(annotation) == "explicit" && mod != nil {
+					mod.Explicit = true
+				}
+			}
+			continue
+		}
+
+		if line[0] == 35 {
+			// Module lines are "# path version", or for replaced modules
+			// "# path version => path version" or "# path version => ./dir"
+			s := strings.Split(line, " ")
+			if !(len(s) == 3 || len(s) == 6 || (len(s) == 5 && s[3] == "=>")) || s[1] == "explicit" {
+				// Don't attribute following packages to the previous module
+				mod = nil
+				continue
+			}
+
+			mod = &ModuleInfo{
+				ImportPath: s[1],
+				Version:    s[2],
+			}
+			if s[2] == "=>" {
+				// issue https://github.com/golang/go/issues/33848 added these,
+				// see comments. I think we can get away with ignoring them.
+				continue
+			}
+			// Handle "replace" in module file if any
+			if len(s) > 3 && s[3] == "=>" {
+				mod.SourcePath = s[4]
+
+				// Handle replaces with a relative target. For example:
+				// "replace github.com/status-im/status-go/protocol => ./protocol"
+				if strings.HasPrefix(s[4], ".") || filepath.IsAbs(s[4]) || strings.HasPrefix(s[4], "/") {
+					mod.Dir, err = filepath.Abs(s[4])
+					if err != nil {
+						return nil, fmt.Errorf("invalid relative path: %v", err)
+					}
+				} else if len(s) == 6 {
+					mod.SourceVersion = s[5]
+					mod.Dir = ModCachePath(mod.SourcePath, mod.SourceVersion)
+				}
+			} else {
+				mod.Dir = ModCachePath(mod.ImportPath, mod.Version)
+			}
+
+			modules = append(modules, mod)
+
+			continue
+		}
+
+		if mod != nil {
+			mod.Pkgs = append(mod.Pkgs, line)
+		}
+	}
+
+	return modules, scanner.Err()
+}
+
+// ImportPathIntersect returns the path of pkgPath relative to the module
+// basePath, ie. "/sub/pkg", or false if the package isn't within the module.
+func ImportPathIntersect(basePath, pkgPath string) (string, bool) {
+	if pkgPath != basePath && !strings.HasPrefix(pkgPath, basePath+"/") {
+		return "", false
+	}
+	return pkgPath[len(basePath):], true
+}
+
+// ModuleOf returns the module providing the package pkgPath, ie. the one with
+// the longest import path containing it, or nil if none does. Major version
+// suffixes are part of module paths, so github.com/foo/bar/v2/x is provided
+// by github.com/foo/bar/v2 if vendored, and otherwise by github.com/foo/bar
+// from its v2 subdirectory.
+func ModuleOf(modules []*ModuleInfo, pkgPath string) *ModuleInfo {
+	var found *ModuleInfo
+	for _, mod := range modules {
+		if _, ok := ImportPathIntersect(mod.ImportPath, pkgPath); !ok {
+			continue
+		}
+		if found == nil || len(mod.ImportPath) > len(found.ImportPath) {
+			found = mod
+		}
+	}
+	return found
+}
+
+// IncludeDirs adds the dirs, given as import paths as with -include, to the
+// packages of the modules. They belong to the module with the longest
+// matching path, so that ie. github.com/foo/bar/v2/parser goes to
+// github.com/foo/bar/v2 rather than github.com/foo/bar
+func IncludeDirs(modules []*ModuleInfo, dirs []string) {
+	for _, dir := range dirs {
+		if mod := ModuleOf(modules, dir); mod != nil {
+			mod.Pkgs = append(mod.Pkgs, dir)
+		}
+	}
+}
+
+// ModCacheDir returns the module cache dir as the go command would, or "" if
+// it can't be located, ie. in containers without HOME and GOPATH.
+func ModCacheDir() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	goPath := os.Getenv("GOPATH")
+	if goPath == "" {
+		// the default GOPATH, ~/go
+		home, err := os.UserHomeDir()
+		if err != nil || home == "" {
+			return ""
+		}
+		goPath = filepath.Join(home, "go")
+	}
+	// The module cache is in the first GOPATH entry
+	return filepath.Join(filepath.SplitList(goPath)[0], "pkg", "mod")
+}
+
+// ModCachePath returns the dir of the module version in the module cache.
+func ModCachePath(importPath, version string) string {
+	return filepath.Join(ModCacheDir(), fmt.Sprintf("%s@%s", EscapePath(importPath), EscapePath(version)))
+}
+
+// EscapePath escapes upper case letters of a module path or version as the
+// module cache does, ie. "github.com/!burnt!sushi".
+func EscapePath(str string) (normStr string) {
+	for _, char := range str {
+		if unicode.IsUpper(char) {
+			normStr += "!" + string(unicode.ToLower(char))
+		} else {
+			normStr += string(char)
+		}
+	}
+	return
+}
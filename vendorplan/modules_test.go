@@ -0,0 +1,50 @@
+package vendorplan
+
+import "testing"
+
+func TestImportPathIntersect(t *testing.T) {
+	for _, test := range []struct {
+		basePath, pkgPath string
+		want              string
+		ok                bool
+	}{
+		{"github.com/pganalyze/pg_query_go/v2", "github.com/pganalyze/pg_query_go/v2", "", true},
+		{"github.com/pganalyze/pg_query_go/v2", "github.com/pganalyze/pg_query_go/v2/parser", "/parser", true},
+		{"github.com/pganalyze/pg_query_go", "github.com/pganalyze/pg_query_go/v2/parser", "/v2/parser", true},
+		{"github.com/pganalyze/pg_query_go/v2", "github.com/pganalyze/pg_query_go/v20/parser", "", false},
+		{"github.com/pganalyze/pg_query_go/v2", "github.com/pganalyze/pg_query_go", "", false},
+		{"github.com/pganalyze/pg_query_go/v2", "github.com/pganalyze/pg_query_go/parser", "", false},
+		{"gopkg.in/yaml.v3", "gopkg.in/yaml.v3", "", true},
+		{"gopkg.in/yaml.v2", "gopkg.in/yaml.v3", "", false},
+	} {
+		got, ok := ImportPathIntersect(test.basePath, test.pkgPath)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ImportPathIntersect(%q, %q) = %q, %v, want %q, %v", test.basePath, test.pkgPath, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestModuleOfMajorVersions(t *testing.T) {
+	modules := []*ModuleInfo{
+		{ImportPath: "github.com/pganalyze/pg_query_go"},
+		{ImportPath: "github.com/pganalyze/pg_query_go/v2"},
+		{ImportPath: "github.com/pganalyze/pg_query_go/v4"},
+	}
+	for pkgPath, want := range map[string]string{
+		"github.com/pganalyze/pg_query_go/v2":        "github.com/pganalyze/pg_query_go/v2",
+		"github.com/pganalyze/pg_query_go/v2/parser": "github.com/pganalyze/pg_query_go/v2",
+		"github.com/pganalyze/pg_query_go/v4/parser": "github.com/pganalyze/pg_query_go/v4",
+		"github.com/pganalyze/pg_query_go/parser":    "github.com/pganalyze/pg_query_go",
+		"github.com/pganalyze/pg_query_go/v3/parser": "github.com/pganalyze/pg_query_go", // its v3 subdir
+		"github.com/pganalyze/pg_query_go/v20":       "github.com/pganalyze/pg_query_go",
+		"github.com/pganalyze/pg_query":              "",
+	} {
+		got := ""
+		if mod := ModuleOf(modules, pkgPath); mod != nil {
+			got = mod.ImportPath
+		}
+		if got != want {
+			t.Errorf("ModuleOf(%q) = %q, want %q", pkgPath, got, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package vendorplan
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ParseRenames reads a -rename mapping file, with one
+// `<module> <from> <to>` line per renamed file, using module relative paths,
+// ie. "github.com/foo/bar include/config_linux.h include/config.h". Blank
+// lines and lines starting with # are ignored. It returns the renames per
+// module import path.
+func ParseRenames(renamePath string) (map[string]map[string]string, error) {
+	f, err := os.Open(renamePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	renames := map[string]map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s := strings.Fields(line)
+		if len(s) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected <module> <from> <to>", renamePath, n)
+		}
+		to := path.Clean(s[2])
+		if path.IsAbs(to) || to == ".." || strings.HasPrefix(to, "../") {
+			return nil, fmt.Errorf("%s:%d: invalid rename to %q, it must stay within the module", renamePath, n, s[2])
+		}
+		if renames[s[0]] == nil {
+			renames[s[0]] = map[string]string{}
+		}
+		renames[s[0]][path.Clean(s[1])] = to
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return renames, nil
+}
+
+// RelPath returns the slash separated path of the file relative to the
+// module dir, or false if the file is outside of it.
+func RelPath(dir, file string) (string, bool) {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// Destination returns the slash separated, vendor dir relative path the
+// module relative relPath of the module importPath is copied to, ie.
+// "github.com/foo/bar/include/x.h": its rename if any, otherwise relPath with
+// the leading components given by strip stripped.
+func Destination(importPath, relPath, strip string, renames map[string]string) string {
+	if to, ok := renames[relPath]; ok {
+		return path.Join(importPath, to)
+	}
+	return path.Join(importPath, StripPath(strip, relPath))
+}
+
+// StripPath strips the leading components of the module relative relPath as
+// given by -strip, either a number of components or a path prefix, ie. "2" or
+// "parser/include". Paths without that many components or outside of the
+// prefix are returned as is.
+func StripPath(strip, relPath string) string {
+	if strip == "" {
+		return relPath
+	}
+	if n, err := strconv.Atoi(strip); err == nil {
+		if n <= 0 {
+			return relPath
+		}
+		parts := strings.SplitN(relPath, "/", n+1)
+		if len(parts) <= n {
+			return relPath
+		}
+		return parts[n]
+	}
+	prefix := strings.Trim(path.Clean(strip), "/") + "/"
+	if !strings.HasPrefix(relPath, prefix) {
+		return relPath
+	}
+	return relPath[len(prefix):]
+}
@@ -0,0 +1,72 @@
+package vendorplan
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IsAnchoredPattern reports whether a copy pattern starts with an import path,
+// ie. "github.com/pganalyze/**/*.c", rather than being module relative. Like
+// import paths, its first element must contain a dot.
+func IsAnchoredPattern(pat string) bool {
+	first := strings.SplitN(pat, "/", 2)[0]
+	return strings.Contains(first, ".") && !strings.HasPrefix(first, ".") &&
+		!strings.ContainsAny(first, "*?[{") && strings.Contains(pat, "/")
+}
+
+// TrimVendorPrefix turns patterns rooted at the vendor dir, ie.
+// "vendor/github.com/foo/**/*.h" as seen in git status, into import path
+// anchored ones. Patterns for a vendor/ dir of the modules themselves, ie.
+// "vendor/*.h", are left as is.
+func TrimVendorPrefix(pats []string, vendorDir string) []string {
+	prefix := filepath.ToSlash(filepath.Clean(vendorDir)) + "/"
+	trimmed := make([]string, len(pats))
+	for i, pat := range pats {
+		trimmed[i] = pat
+		if rest := strings.TrimPrefix(pat, prefix); rest != pat && IsAnchoredPattern(rest) {
+			trimmed[i] = rest
+		}
+	}
+	return trimmed
+}
+
+// AnchorPattern resolves an import path anchored pattern against the module
+// importPath, returning the rest of the pattern relative to the module root,
+// or false if the module doesn't match. The import path elements are matched
+// one by one, and a "**" matches all remaining ones, so
+// "github.com/pganalyze/**/*.c" applies "**/*.c" to all modules under
+// github.com/pganalyze.
+func AnchorPattern(importPath, pat string) (string, bool) {
+	patSegs := strings.Split(pat, "/")
+	for _, modSeg := range strings.Split(importPath, "/") {
+		if len(patSegs) == 0 {
+			return "", false
+		}
+		if patSegs[0] == "**" {
+			break
+		}
+		if ok, _ := path.Match(patSegs[0], modSeg); !ok {
+			return "", false
+		}
+		patSegs = patSegs[1:]
+	}
+	if len(patSegs) == 0 {
+		return "", false
+	}
+	return strings.Join(patSegs, "/"), true
+}
+
+// ModulePatterns returns the copy patterns applying to the module importPath,
+// with the import path anchored ones resolved relative to it.
+func ModulePatterns(importPath string, pats []string) []string {
+	modPats := []string{}
+	for _, pat := range pats {
+		if !IsAnchoredPattern(pat) {
+			modPats = append(modPats, pat)
+		} else if rest, ok := AnchorPattern(importPath, pat); ok {
+			modPats = append(modPats, rest)
+		}
+	}
+	return modPats
+}
@@ -0,0 +1,4 @@
+package vendorplan
+
+// seekHole is SEEK_HOLE of <sys/unistd.h>
+const seekHole = 3
@@ -0,0 +1,7 @@
+//go:build linux || freebsd
+// +build linux freebsd
+
+package vendorplan
+
+// seekHole is SEEK_HOLE of <unistd.h>
+const seekHole = 4
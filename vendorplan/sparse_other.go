@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package vendorplan
+
+import (
+	"os"
+)
+
+// isSparse always reports false, as holes can't be found on this platform.
+func isSparse(f *os.File, size int64) (bool, error) {
+	return false, nil
+}
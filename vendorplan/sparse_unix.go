@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package vendorplan
+
+import (
+	"io"
+	"os"
+)
+
+// isSparse reports whether the file has holes before its end, as found by
+// seeking to the first one with SEEK_HOLE. Filesystems without hole support
+// report none. The offset of f is reset to its start.
+func isSparse(f *os.File, size int64) (bool, error) {
+	hole, err := f.Seek(0, seekHole)
+	if err != nil {
+		// ie. EINVAL from kernels without SEEK_HOLE
+		return false, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return hole < size, nil
+}
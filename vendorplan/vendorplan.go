@@ -0,0 +1,223 @@
+// Package vendorplan plans the file copies modvendor makes into ./vendor/,
+// separately from executing them, ie. for dry-runs, diffs or custom
+// executors:
+//
+//	actions, err := vendorplan.Plan(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	for _, action := range actions {
+//		fmt.Println(action.Module, action.Destination, action.Size)
+//	}
+//	return vendorplan.Apply(actions)
+//
+// The modules are resolved from vendor/modules.txt as modvendor does, given
+// the copy patterns and flags, or their files can be listed explicitly:
+//
+//	cfg := vendorplan.Config{
+//		VendorDir:   "vendor",
+//		ModulesFile: "vendor/modules.txt",
+//		Patterns:    []string{"**/*.c", "**/*.h"},
+//	}
+package vendorplan
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Config is what to vendor: the files of each module with their
+// destinations, as listed in Modules, plus those resolved from ModulesFile.
+type Config struct {
+	VendorDir string // default destination dir, ie. vendor
+	Modules   []*Module
+
+	// The modules of ModulesFile, ie. vendor/modules.txt, are resolved as by
+	// modvendor: the files within their packages and the Include dirs which
+	// match the Patterns, copied to their import path in VendorDir, with
+	// the Strip and Renames of their module applied.
+	ModulesFile string
+	Patterns    []string                     // copy patterns, as -copy
+	Include     []string                     // more package dirs, as -include
+	Strip       map[string]string            // module import path -> -strip
+	Renames     map[string]map[string]string // module import path -> ParseRenames renames
+}
+
+// Module is a module to vendor files of.
+type Module struct {
+	Name   string // as reported, ie. "github.com/foo/bar@v1.2.3"
+	Source Source // reads the files, from disk by their paths if nil
+	Files  []*File
+}
+
+// Source reads the files of a module by their paths, ie. from its dir or zip
+// in the module cache.
+type Source interface {
+	Open(name string) (io.ReadCloser, os.FileInfo, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+// File is a file of a module to vendor.
+type File struct {
+	Path        string // path the module's Source reads it by, ie. its full path
+	Dir         string // destination dir, Config.VendorDir if empty
+	Destination string // slash separated, relative to Dir
+	Reason      string // ie. "pattern **/*.h"
+}
+
+// CopyAction is a single planned file copy, as printed by `modvendor -plan`.
+type CopyAction struct {
+	Module      string `json:"module"`      // ie. "github.com/foo/bar@v1.2.3"
+	Source      string `json:"source"`      // full path, or zip path#entry for module zips
+	Dir         string `json:"dir"`         // destination dir, ie. ./vendor/ or a -copy-to dir
+	Destination string `json:"destination"` // relative to Dir
+	Size        int64  `json:"size"`
+	Reason      string `json:"reason"` // ie. "pattern **/*.h"
+
+	source Source
+	file   *File
+}
+
+// File returns the planned file of the action.
+func (a *CopyAction) File() *File {
+	return a.file
+}
+
+// open opens the source file of the action.
+func (a *CopyAction) open() (io.ReadCloser, os.FileInfo, error) {
+	return openFile(a.source, a.file.Path)
+}
+
+// FileError is a file of a module which couldn't be stat'ed when planning,
+// or copied when applying.
+type FileError struct {
+	Module string
+	File   *File
+	Op     string // ie. "stat" or "copy"
+	Err    error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("module %s: %s %s: %v", e.Module, e.Op, e.File.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Resolve returns the modules of the config, with those of its ModulesFile
+// resolved, if set.
+func Resolve(cfg Config) ([]*Module, error) {
+	modules := append([]*Module{}, cfg.Modules...)
+	if cfg.ModulesFile == "" {
+		return modules, nil
+	}
+	infos, err := ParseModulesFile(cfg.ModulesFile)
+	if err != nil {
+		return nil, err
+	}
+	IncludeDirs(infos, cfg.Include)
+	patterns := TrimVendorPrefix(cfg.Patterns, cfg.VendorDir)
+	for _, info := range infos {
+		pats := ModulePatterns(info.ImportPath, patterns)
+		if len(pats) == 0 {
+			continue
+		}
+		matches, err := Glob(info.Dir, pats, 0, NewPkgFilter(info))
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %v", info, err)
+		}
+		compiled, err := CompilePatterns(info.Dir, pats)
+		if err != nil {
+			return nil, err
+		}
+		files := make([]string, 0, len(matches))
+		for file := range matches {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+
+		mod := &Module{Name: info.String()}
+		for _, file := range files {
+			relPath, _ := RelPath(info.Dir, file)
+			f := &File{
+				Path:        file,
+				Destination: Destination(info.ImportPath, relPath, cfg.Strip[info.ImportPath], cfg.Renames[info.ImportPath]),
+			}
+			for _, p := range compiled {
+				if p.Match(file) {
+					f.Reason = "pattern " + p.String()
+					break
+				}
+			}
+			mod.Files = append(mod.Files, f)
+		}
+		modules = append(modules, mod)
+	}
+	return modules, nil
+}
+
+// Plan returns the copy actions for the files of the modules, ordered by
+// destination, and for the same destination in module order. Nothing is
+// written.
+func Plan(cfg Config) ([]*CopyAction, error) {
+	modules, err := Resolve(cfg)
+	if err != nil {
+		return nil, err
+	}
+	actions := []*CopyAction{}
+	for _, mod := range modules {
+		for _, f := range mod.Files {
+			info, err := statFile(mod.Source, f.Path)
+			if err != nil {
+				return nil, &FileError{Module: mod.Name, File: f, Op: "stat", Err: err}
+			}
+			dir := f.Dir
+			if dir == "" {
+				dir = cfg.VendorDir
+			}
+			actions = append(actions, &CopyAction{
+				Module:      mod.Name,
+				Source:      f.Path,
+				Dir:         dir,
+				Destination: f.Destination,
+				Size:        info.Size(),
+				Reason:      f.Reason,
+				source:      mod.Source,
+				file:        f,
+			})
+		}
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].Dir != actions[j].Dir {
+			return actions[i].Dir < actions[j].Dir
+		}
+		return actions[i].Destination < actions[j].Destination
+	})
+	return actions, nil
+}
+
+func openFile(src Source, name string) (io.ReadCloser, os.FileInfo, error) {
+	if src != nil {
+		return src.Open(name)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+func statFile(src Source, name string) (os.FileInfo, error) {
+	if src != nil {
+		return src.Stat(name)
+	}
+	return os.Stat(name)
+}
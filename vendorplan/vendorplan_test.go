@@ -0,0 +1,255 @@
+package vendorplan
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testConfig(t *testing.T) Config {
+	modDir := t.TempDir()
+	writeFiles(t, modDir, map[string]string{
+		"include/x.h": "#define X 1\n",
+		"src/f.c":     "int f;\n",
+	})
+	return Config{
+		VendorDir: filepath.Join(t.TempDir(), "vendor"),
+		Modules: []*Module{{
+			Name: "github.com/foo/bar@v1.2.3",
+			Files: []*File{
+				{Path: filepath.Join(modDir, "src", "f.c"), Destination: "github.com/foo/bar/src/f.c", Reason: "pattern **/*.c"},
+				{Path: filepath.Join(modDir, "include", "x.h"), Destination: "github.com/foo/bar/include/x.h", Reason: "pattern **/*.h"},
+			},
+		}},
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	cfg := testConfig(t)
+	actions, err := Plan(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("got %d actions, want 2", len(actions))
+	}
+	want := []struct {
+		destination, reason string
+		size                int64
+	}{
+		{"github.com/foo/bar/include/x.h", "pattern **/*.h", 12},
+		{"github.com/foo/bar/src/f.c", "pattern **/*.c", 7},
+	}
+	for i, w := range want {
+		a := actions[i]
+		if a.Module != "github.com/foo/bar@v1.2.3" || a.Dir != cfg.VendorDir || a.Destination != w.destination || a.Reason != w.reason || a.Size != w.size {
+			t.Errorf("action %d = %+v, want %s (%s, %d bytes)", i, a, w.destination, w.reason, w.size)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.VendorDir, filepath.FromSlash(a.Destination))); !os.IsNotExist(err) {
+			t.Errorf("%s was written by Plan", a.Destination)
+		}
+	}
+
+	if err := Apply(actions); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range actions {
+		dst := filepath.Join(cfg.VendorDir, filepath.FromSlash(a.Destination))
+		data, err := ioutil.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(data)) != a.Size {
+			t.Errorf("%s: got %d bytes, want %d", a.Destination, len(data), a.Size)
+		}
+		if info, _ := os.Stat(dst); info.Mode().Perm()&0200 == 0 {
+			t.Errorf("%s: mode %v isn't owner-writable", a.Destination, info.Mode())
+		}
+	}
+
+	// Files are replaced on later runs, although copied from read-only ones
+	if err := Apply(actions); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanMissingFile(t *testing.T) {
+	cfg := testConfig(t)
+	missing := &File{Path: filepath.Join(t.TempDir(), "gone.h"), Destination: "github.com/foo/bar/gone.h"}
+	cfg.Modules[0].Files = append(cfg.Modules[0].Files, missing)
+
+	_, err := Plan(cfg)
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) || fileErr.File != missing || fileErr.Op != "stat" || !os.IsNotExist(fileErr.Err) {
+		t.Fatalf("got error %v, want a stat FileError for %s", err, missing.Path)
+	}
+}
+
+func TestApplierHooks(t *testing.T) {
+	actions, err := Plan(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied := []string{}
+	failed := []string{}
+	applier := &Applier{
+		Copy: func(action *CopyAction, dst string) (int64, error) {
+			if action.Reason == "pattern **/*.h" {
+				return 0, errors.New("no headers")
+			}
+			copied = append(copied, action.Destination)
+			return action.Size, nil
+		},
+		Failed: func(action *CopyAction, err error) {
+			var fileErr *FileError
+			if !errors.As(err, &fileErr) || fileErr.Op != "copy" || fileErr.File != action.File() {
+				t.Errorf("%s: got error %v, want a copy FileError", action.Destination, err)
+			}
+			failed = append(failed, action.Destination)
+		},
+	}
+	if err := applier.Apply(actions); err != nil {
+		t.Fatal(err)
+	}
+	if len(copied) != 1 || copied[0] != "github.com/foo/bar/src/f.c" {
+		t.Errorf("copied %v, want only the .c file", copied)
+	}
+	if len(failed) != 1 || failed[0] != "github.com/foo/bar/include/x.h" {
+		t.Errorf("failed %v, want only the .h file", failed)
+	}
+
+	// Without a Failed hook, the first failure is returned
+	applier.Failed = nil
+	copied = copied[:0]
+	if err := applier.Apply(actions); err == nil || len(copied) != 0 {
+		t.Errorf("got error %v after copying %v, want the first failure", err, copied)
+	}
+}
+
+func TestFS(t *testing.T) {
+	cfg := testConfig(t)
+	other := *cfg.Modules[0].Files[0]
+	other.Dir = "third_party"
+	cfg.Modules[0].Files = append(cfg.Modules[0].Files, &other)
+
+	fsys, err := FS(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "github.com/foo/bar/include/x.h", "github.com/foo/bar/src/f.c"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(fsys, "github.com/foo/bar/include/x.h")
+	if err != nil || string(data) != "#define X 1\n" {
+		t.Errorf("got %q, %v, want the module file", data, err)
+	}
+
+	// Files planned into other dirs aren't in the FS
+	entries, err := fs.ReadDir(fsys, "github.com/foo/bar")
+	if err != nil || len(entries) != 2 {
+		t.Errorf("got entries %v, %v, want include and src", entries, err)
+	}
+
+	// Nothing was written
+	if _, err := os.Stat(cfg.VendorDir); !os.IsNotExist(err) {
+		t.Errorf("%s was created", cfg.VendorDir)
+	}
+}
+
+func TestFSInvalidDestination(t *testing.T) {
+	for _, dst := range []string{"../x.h", "/x.h", "a//x.h", "github.com/foo/bar/src/f.c/x.h"} {
+		cfg := testConfig(t)
+		cfg.Modules[0].Files = append(cfg.Modules[0].Files, &File{Path: cfg.Modules[0].Files[0].Path, Destination: dst})
+		if _, err := FS(cfg); err == nil {
+			t.Errorf("%s: got no error", dst)
+		}
+	}
+}
+
+func TestPlanModulesFile(t *testing.T) {
+	modCache := t.TempDir()
+	t.Setenv("GOMODCACHE", modCache)
+	writeFiles(t, filepath.Join(modCache, "github.com", "!foo", "bar@v1.2.3"), map[string]string{
+		"parser/include/x.h":        "x",
+		"parser/include/config_l.h": "config",
+		"parser/p.c":                "p",
+		"unused/u.h":                "u",
+		"third_party/t.h":           "t",
+		"docs/d.md":                 "d",
+	})
+	writeFiles(t, filepath.Join(modCache, "github.com", "other", "mod@v0.1.0"), map[string]string{
+		"o.h": "o",
+	})
+	vendorDir := t.TempDir()
+	modtxt := filepath.Join(vendorDir, "modules.txt")
+	if err := ioutil.WriteFile(modtxt, []byte(`# github.com/Foo/bar v1.2.3
+## explicit
+github.com/Foo/bar/parser
+# github.com/other/mod v0.1.0
+github.com/other/mod
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		VendorDir:   vendorDir,
+		ModulesFile: modtxt,
+		Patterns:    []string{"**/*.h", filepath.ToSlash(vendorDir) + "/github.com/Foo/**/*.c"},
+		Include:     []string{"github.com/Foo/bar/third_party"},
+		Strip:       map[string]string{"github.com/Foo/bar": "parser"},
+		Renames:     map[string]map[string]string{"github.com/Foo/bar": {"parser/include/config_l.h": "include/config.h"}},
+	}
+	actions, err := Plan(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ module, destination, reason string }{
+		{"github.com/Foo/bar@v1.2.3", "github.com/Foo/bar/include/config.h", "pattern **/*.h"},
+		{"github.com/Foo/bar@v1.2.3", "github.com/Foo/bar/include/x.h", "pattern **/*.h"},
+		{"github.com/Foo/bar@v1.2.3", "github.com/Foo/bar/p.c", "pattern **/*.c"},
+		{"github.com/Foo/bar@v1.2.3", "github.com/Foo/bar/third_party/t.h", "pattern **/*.h"},
+		{"github.com/other/mod@v0.1.0", "github.com/other/mod/o.h", "pattern **/*.h"},
+	}
+	if len(actions) != len(want) {
+		t.Fatalf("got %d actions, want %d", len(actions), len(want))
+	}
+	for i, w := range want {
+		if a := actions[i]; a.Module != w.module || a.Destination != w.destination || a.Reason != w.reason || a.Dir != vendorDir {
+			t.Errorf("action %d = %s %s (%s), want %s %s (%s)", i, a.Module, a.Destination, a.Reason, w.module, w.destination, w.reason)
+		}
+	}
+
+	// The FS has the same files
+	fsys, err := FS(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, w := range want {
+		names = append(names, w.destination)
+	}
+	if err := fstest.TestFS(fsys, names...); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile(fsys, "github.com/Foo/bar/include/config.h"); err != nil || string(data) != "config" {
+		t.Errorf("got %q, %v, want the renamed file", data, err)
+	}
+}
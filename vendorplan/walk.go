@@ -0,0 +1,383 @@
+package vendorplan
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-zglob/fastwalk"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SkipDirs are never descended into when walking modules
+var SkipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+}
+
+// Pattern is a copy pattern compiled for matching files of a module
+type Pattern struct {
+	pattern  string
+	re       *regexp.Regexp
+	segments []*regexp.Regexp // nil entry for "**"
+}
+
+// String returns the pattern as given.
+func (p *Pattern) String() string {
+	return p.pattern
+}
+
+// Match reports whether the file, a full path within the module dir, matches
+// the pattern.
+func (p *Pattern) Match(name string) bool {
+	return p.re.MatchString(filepath.ToSlash(name))
+}
+
+// CompilePattern compiles the copy pattern for matching files of the
+// module dir. Besides "*" and "**/", patterns support "?", character classes
+// ("[ch]", "[!.]") and alternatives ("{include,src}"), see globExpr.
+func CompilePattern(dir, pat string) (*Pattern, error) {
+	pat = path.Clean(filepath.ToSlash(norm.NFC.String(pat)))
+	expr, err := globExpr(pat)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		expr = regexp.QuoteMeta(strings.TrimSuffix(filepath.ToSlash(filepath.Clean(dir)), "/")) + "/" + expr
+	}
+	re, err := compileGlob(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pattern{pattern: pat, re: re}
+	for _, seg := range splitGlob(pat) {
+		if seg == "**" {
+			p.segments = append(p.segments, nil)
+			continue
+		}
+		// Alternatives spanning dirs, ie. "{include,src/x}/*.h", can't be
+		// matched segment by segment, so nothing is pruned for them
+		if strings.Contains(seg, "/") {
+			p.segments = []*regexp.Regexp{nil}
+			break
+		}
+		expr, _ := globExpr(seg)
+		re, err := compileGlob(expr)
+		if err != nil {
+			return nil, err
+		}
+		p.segments = append(p.segments, re)
+	}
+	return p, nil
+}
+
+// MatchPattern reports whether the file of the module dir matches the copy
+// pattern.
+func MatchPattern(dir, pat, name string) bool {
+	p, err := CompilePattern(dir, pat)
+	return err == nil && p.Match(name)
+}
+
+// compileGlob compiles the whole path expression of globExpr, ignoring case
+// where file systems usually do.
+func compileGlob(expr string) (*regexp.Regexp, error) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		expr = "(?i:" + expr + ")"
+	}
+	return regexp.Compile("^" + expr + "$")
+}
+
+// globExpr translates the slash separated glob pattern to a regular
+// expression. "**/" matches any number of dirs, "*" any part of a path
+// segment and "?" any one character of it, "[...]" any (with a leading "!"
+// or "^", none) of the characters or ranges of the class, and "{a,b}" any of
+// the comma separated, possibly nested alternatives.
+func globExpr(pat string) (string, error) {
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(pat); i++ {
+		switch c := pat[i]; {
+		case strings.HasPrefix(pat[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := classEnd(pat, i)
+			if end < 0 {
+				return "", fmt.Errorf("pattern %s: unterminated [", pat)
+			}
+			class := pat[i+1 : end]
+			if strings.Contains(class, "/") {
+				return "", fmt.Errorf("pattern %s: / in character class", pat)
+			}
+			b.WriteByte('[')
+			if class[0] == '!' || class[0] == '^' {
+				b.WriteString("^/")
+				class = class[1:]
+			}
+			for _, r := range class {
+				if r == '\\' || r == '[' || r == ']' || r == '^' {
+					b.WriteByte('\\')
+				}
+				b.WriteRune(r)
+			}
+			b.WriteByte(']')
+			i = end
+		case c == '{':
+			depth++
+			b.WriteString("(?:")
+		case c == ',' && depth > 0:
+			b.WriteByte('|')
+		case c == '}' && depth > 0:
+			depth--
+			b.WriteByte(')')
+		default:
+			b.WriteString(regexp.QuoteMeta(pat[i : i+1]))
+		}
+	}
+	if depth > 0 {
+		return "", fmt.Errorf("pattern %s: unterminated {", pat)
+	}
+	return b.String(), nil
+}
+
+// classEnd returns the index of the "]" closing the character class opened
+// at pat[i], or -1. A "]" right after the opening "[" or "[!" is part of the
+// class.
+func classEnd(pat string, i int) int {
+	j := i + 1
+	if j < len(pat) && (pat[j] == '!' || pat[j] == '^') {
+		j++
+	}
+	if j < len(pat) && pat[j] == ']' {
+		j++
+	}
+	if k := strings.IndexByte(pat[j:], ']'); k >= 0 {
+		return j + k
+	}
+	return -1
+}
+
+// splitGlob splits the pattern into its path segments, keeping alternatives
+// and character classes whole.
+func splitGlob(pat string) []string {
+	segs := []string{}
+	depth, start := 0, 0
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '[':
+			if end := classEnd(pat, i); end >= 0 {
+				i = end
+			}
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				segs = append(segs, pat[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segs, pat[start:])
+}
+
+// CanMatchBelow reports whether files below the module relative directory
+// dir (split into its path segments) could match the pattern.
+func (p *Pattern) CanMatchBelow(dir []string) bool {
+	segs := p.segments
+	for _, name := range dir {
+		if len(segs) == 0 {
+			return false
+		}
+		if segs[0] == nil {
+			return true
+		}
+		if !segs[0].MatchString(name) {
+			return false
+		}
+		segs = segs[1:]
+	}
+	return len(segs) > 0
+}
+
+// PkgFilter restricts the files of a module to those within the directories
+// of its packages, given as module relative paths with a leading slash, ie.
+// "/sub/pkg". Files anywhere below a package dir are kept, ie.
+// /sub/pkg/include/x.h, but not those of sibling dirs sharing its name as a
+// prefix, ie. /sub/pkgx/y.h. A nil PkgFilter keeps all files.
+type PkgFilter []string
+
+// NewPkgFilter returns the filter for the module's packages, or nil if its
+// root package is used or it has no packages listed at all. Packages are
+// listed under the module's own import path, also for modules replaced by
+// another module path.
+func NewPkgFilter(mod *ModuleInfo) PkgFilter {
+	if mod.Pkgs == nil {
+		return nil
+	}
+	filter := PkgFilter{}
+	for _, pkg := range mod.Pkgs {
+		pkgDir, ok := ImportPathIntersect(mod.ImportPath, pkg)
+		if !ok {
+			continue
+		}
+		if pkgDir == "" {
+			return nil
+		}
+		filter = append(filter, pkgDir)
+	}
+	return filter
+}
+
+// Keep reports whether the module relative, slash separated file is kept.
+func (f PkgFilter) Keep(relPath string) bool {
+	if f == nil {
+		return true
+	}
+	for _, pkgDir := range f {
+		if strings.HasPrefix("/"+relPath, pkgDir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CanKeepBelow reports whether any files below the module relative directory
+// could be kept.
+func (f PkgFilter) CanKeepBelow(relDir string) bool {
+	if f == nil {
+		return true
+	}
+	for _, pkgDir := range f {
+		if strings.HasPrefix("/"+relDir+"/", pkgDir+"/") || strings.HasPrefix(pkgDir+"/", "/"+relDir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// TooManyMatchesError is returned when a pattern matches more files of a
+// module than allowed by -max-matches-per-pattern
+type TooManyMatchesError struct {
+	Pattern string
+	Limit   int
+}
+
+func (e *TooManyMatchesError) Error() string {
+	return fmt.Sprintf("pattern %s: matched more than %d files, stopping (raise -max-matches-per-pattern if this is intended)", e.Pattern, e.Limit)
+}
+
+// CompilePatterns compiles the copy patterns for matching files of the
+// module dir.
+func CompilePatterns(dir string, copyPat []string) ([]*Pattern, error) {
+	patterns := []*Pattern{}
+	for _, pat := range copyPat {
+		p, err := CompilePattern(dir, pat)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// Glob walks the module directory once, returning all files matching any of
+// the copy patterns and kept by pkgs. Files are filtered as they're
+// found, so huge modules don't hold all candidates in memory. Directories
+// which can't contain matches for any pattern or package are pruned, as are
+// SkipDirs and nested modules. The walk is stopped once any pattern matches
+// more than maxMatches files, if set.
+func Glob(dir string, copyPat []string, maxMatches int, pkgs PkgFilter) (map[string]bool, error) {
+	patterns, err := CompilePatterns(dir, copyPat)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	matches := map[string]bool{}
+	counts := make([]int, len(patterns))
+
+	err = fastwalk.FastWalk(dir, func(path string, typ os.FileMode) error {
+		if path == dir {
+			return nil
+		}
+		rel := norm.NFC.String(filepath.ToSlash(path[len(dir)+1:]))
+
+		if typ.IsDir() {
+			if SkipDirs[filepath.Base(path)] || !pkgs.CanKeepBelow(rel) {
+				return filepath.SkipDir
+			}
+			segs := strings.Split(rel, "/")
+			for _, p := range patterns {
+				if p.CanMatchBelow(segs) {
+					// Nested modules aren't part of this module
+					if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			return filepath.SkipDir
+		}
+
+		if !pkgs.Keep(rel) {
+			return nil
+		}
+		name := filepath.Join(dir, filepath.FromSlash(rel))
+		mu.Lock()
+		defer mu.Unlock()
+		for i, p := range patterns {
+			if p.Match(name) {
+				matches[path] = false
+				counts[i]++
+				if maxMatches > 0 && counts[i] > maxMatches {
+					return &TooManyMatchesError{p.pattern, maxMatches}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// CheckMaxMatches returns a TooManyMatchesError if any pattern matches more
+// than maxMatches of the given files, ie. for previously cached glob results.
+func CheckMaxMatches(dir string, copyPat []string, matches map[string]bool, maxMatches int) error {
+	if maxMatches <= 0 {
+		return nil
+	}
+	patterns, err := CompilePatterns(dir, copyPat)
+	if err != nil {
+		return err
+	}
+	for _, p := range patterns {
+		count := 0
+		for m := range matches {
+			rel := norm.NFC.String(filepath.ToSlash(m[len(dir)+1:]))
+			if p.Match(filepath.Join(dir, filepath.FromSlash(rel))) {
+				count++
+			}
+		}
+		if count > maxMatches {
+			return &TooManyMatchesError{p.pattern, maxMatches}
+		}
+	}
+	return nil
+}
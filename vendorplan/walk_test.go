@@ -0,0 +1,165 @@
+package vendorplan
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPkgFilterMajorVersions(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		importPath string
+		pkgs       []string
+		keep       []string
+		drop       []string
+	}{
+		{
+			name:       "v2 module",
+			importPath: "github.com/pganalyze/pg_query_go/v2",
+			pkgs:       []string{"github.com/pganalyze/pg_query_go/v2/parser"},
+			keep:       []string{"parser/pg_query.h", "parser/include/nodes/nodes.h"},
+			drop:       []string{"pg_query.h", "parserx/x.h", "v2/parser/x.h"},
+		},
+		{
+			name:       "v2 module root package",
+			importPath: "github.com/pganalyze/pg_query_go/v2",
+			pkgs:       []string{"github.com/pganalyze/pg_query_go/v2", "github.com/pganalyze/pg_query_go/v2/parser"},
+			keep:       []string{"pg_query.h", "parserx/x.h", "parser/pg_query.h"},
+		},
+		{
+			name:       "v2 subdir of a v1 module",
+			importPath: "github.com/pganalyze/pg_query_go",
+			pkgs:       []string{"github.com/pganalyze/pg_query_go/v2/parser"},
+			keep:       []string{"v2/parser/pg_query.h"},
+			drop:       []string{"parser/pg_query.h", "v2/pg_query.h", "v20/parser/x.h"},
+		},
+		{
+			name:       "packages of other modules",
+			importPath: "github.com/pganalyze/pg_query_go/v2",
+			pkgs:       []string{"github.com/pganalyze/pg_query_go/parser", "github.com/pganalyze/pg_query_go/v20/parser"},
+			drop:       []string{"parser/pg_query.h", "pg_query.h"},
+		},
+		{
+			name:       "gopkg.in module",
+			importPath: "gopkg.in/yaml.v3",
+			pkgs:       []string{"gopkg.in/yaml.v3/internal"},
+			keep:       []string{"internal/x.h"},
+			drop:       []string{"x.h"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			filter := NewPkgFilter(&ModuleInfo{ImportPath: test.importPath, Pkgs: test.pkgs})
+			for _, relPath := range test.keep {
+				if !filter.Keep(relPath) {
+					t.Errorf("%s is dropped, want it kept", relPath)
+				}
+			}
+			for _, relPath := range test.drop {
+				if filter.Keep(relPath) {
+					t.Errorf("%s is kept, want it dropped", relPath)
+				}
+			}
+		})
+	}
+}
+
+func TestPkgFilterCanKeepBelow(t *testing.T) {
+	filter := NewPkgFilter(&ModuleInfo{
+		ImportPath: "github.com/pganalyze/pg_query_go",
+		Pkgs:       []string{"github.com/pganalyze/pg_query_go/v2/parser"},
+	})
+	for dir, want := range map[string]bool{
+		"v2":              true,
+		"v2/parser":       true,
+		"v2/parser/nodes": true,
+		"v20":             false,
+		"v2/parserx":      false,
+		"parser":          false,
+		"v2/src/postgres": false,
+	} {
+		if got := filter.CanKeepBelow(dir); got != want {
+			t.Errorf("CanKeepBelow(%q) = %v, want %v", dir, got, want)
+		}
+	}
+}
+
+func TestGlobPatternSyntax(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for _, name := range []string{"include/x.h", "src/y.h", "lib/z.h", "lib1/a.h", "lib12/b.h", "other/c.h", "include/deep/d.h", "src/e.c"} {
+		files[name] = name
+	}
+	writeFiles(t, dir, files)
+
+	for _, test := range []struct {
+		pattern string
+		want    []string
+		below   map[string]bool // dir -> CanMatchBelow
+	}{
+		{
+			pattern: "{include,src}/*.h",
+			want:    []string{"include/x.h", "src/y.h"},
+			below:   map[string]bool{"include": true, "src": true, "lib": false, "include/deep": false},
+		},
+		{
+			pattern: "lib?/*.h",
+			want:    []string{"lib1/a.h"},
+			below:   map[string]bool{"lib1": true, "lib": false, "lib12": false},
+		},
+		{
+			pattern: "[il]*/*.h",
+			want:    []string{"include/x.h", "lib/z.h", "lib1/a.h", "lib12/b.h"},
+			below:   map[string]bool{"include": true, "lib12": true, "src": false, "other": false},
+		},
+		{
+			pattern: "[!il]*/*.[ch]",
+			want:    []string{"other/c.h", "src/e.c", "src/y.h"},
+			below:   map[string]bool{"src": true, "include": false},
+		},
+		{
+			pattern: "{include/deep,lib}/*.h",
+			want:    []string{"include/deep/d.h", "lib/z.h"},
+			below:   map[string]bool{"include": true, "include/deep": true},
+		},
+	} {
+		t.Run(test.pattern, func(t *testing.T) {
+			matches, err := Glob(dir, []string{test.pattern}, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for m := range matches {
+				got = append(got, filepath.ToSlash(m[len(dir)+1:]))
+			}
+			sort.Strings(got)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			for _, rel := range test.want {
+				if !MatchPattern(dir, test.pattern, filepath.Join(dir, filepath.FromSlash(rel))) {
+					t.Errorf("MatchPattern(%s) = false, want true", rel)
+				}
+			}
+
+			p, err := CompilePattern(dir, test.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for below, want := range test.below {
+				if got := p.CanMatchBelow(strings.Split(below, "/")); got != want {
+					t.Errorf("CanMatchBelow(%q) = %v, want %v", below, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompilePatternErrors(t *testing.T) {
+	for _, pat := range []string{"include/[ch", "{include,src/*.h", "[a/b]/*.h", "[z-a]/*.h"} {
+		if _, err := CompilePattern("", pat); err == nil {
+			t.Errorf("%s: got no error", pat)
+		}
+	}
+}
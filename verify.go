@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// verifyManifest recomputes the hashes of the files recorded in the manifest
+// under vendorDir, returning the vendor relative paths of the files which were
+// modified or deleted since.
+func verifyManifest(vendorDir string, manifest *Manifest) (modified, deleted []string, err error) {
+	for _, mm := range manifest.Modules {
+		for file, sum := range mm.Files {
+			f, err := os.Open(longPath(filepath.Join(vendorDir, filepath.FromSlash(file))))
+			if os.IsNotExist(err) {
+				deleted = append(deleted, file)
+				continue
+			} else if err != nil {
+				return nil, nil, err
+			}
+			cur, err := readerSHA256(f)
+			f.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			if cur != sum {
+				modified = append(modified, file)
+			}
+		}
+	}
+	sort.Strings(modified)
+	sort.Strings(deleted)
+	return modified, deleted, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// buildVersion is the release version, set by release builds with
+// -ldflags="-X main.buildVersion=<tag>", as builds from a checkout only know
+// their version since go1.24.
+var buildVersion string
+
+// moduleVersion returns the modvendor version of this build, ie. "v0.5.0", or
+// "(devel)" if unknown.
+func moduleVersion() string {
+	if buildVersion != "" {
+		return buildVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// versionString returns the modvendor module version, VCS revision and Go
+// version of this build, ie. "modvendor v0.5.0 (rev 1a2b3c4, 2020-01-02T15:04:05Z) go1.14"
+func versionString() string {
+	version, revision, revTime, modified := moduleVersion(), "", "", false
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.time":
+				revTime = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+
+	s := fmt.Sprintf("modvendor %s", version)
+	if revision != "" {
+		s += fmt.Sprintf(" (rev %s", revision)
+		if revTime != "" {
+			s += ", " + revTime
+		}
+		if modified {
+			s += ", modified"
+		}
+		s += ")"
+	}
+	return s + " " + runtime.Version()
+}
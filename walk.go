@@ -0,0 +1,13 @@
+package main
+
+import "github.com/goware/modvendor/vendorplan"
+
+// modPkgFilter returns the filter for the module's packages, or nil if its
+// root package is used, it has no packages listed at all (ie. diff-module),
+// or -all-files applies to it.
+func modPkgFilter(mod *Mod) vendorplan.PkgFilter {
+	if allFiles.applies(mod.ImportPath) {
+		return nil
+	}
+	return vendorplan.NewPkgFilter(&mod.ModuleInfo)
+}
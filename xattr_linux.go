@@ -0,0 +1,44 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"strings"
+	"syscall"
+)
+
+const xattrsSupported = true
+
+// copyXattrs copies all extended attributes of src to dst, which includes
+// POSIX ACLs (system.posix_acl_*) and SELinux contexts (security.selinux).
+func copyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err != nil || size == 0 {
+		return err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(src, buf)
+	if err != nil {
+		return err
+	}
+
+	for _, attr := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if attr == "" {
+			continue
+		}
+		vsize, err := syscall.Getxattr(src, attr, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, vsize)
+		vsize, err = syscall.Getxattr(src, attr, value)
+		if err != nil {
+			return err
+		}
+		if err := syscall.Setxattr(dst, attr, value[:vsize], 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
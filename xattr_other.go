@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+const xattrsSupported = false
+
+func copyXattrs(src, dst string) error {
+	return errors.New("extended attributes aren't supported on this platform")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goware/modvendor/vendorplan"
+)
+
+// modZip gives access to the files of a module zip in the module cache, for
+// modules whose extracted directory isn't present.
+type modZip struct {
+	Path   string
+	Prefix string // entry name prefix, ie. "github.com/foo/bar@v1.2.3/"
+
+	once  sync.Once
+	err   error
+	file  *reopenFile
+	files map[string]*zip.File // module relative path -> zip entry
+}
+
+func modZipPath(importPath, version string) string {
+	return filepath.Join(vendorplan.ModCacheDir(), "cache", "download", vendorplan.EscapePath(importPath), "@v", vendorplan.EscapePath(version)+".zip")
+}
+
+// findModZip returns the module cache zip of the module, or nil if it isn't
+// in the cache either.
+func findModZip(mod *Mod) *modZip {
+	if !inModCache(mod) {
+		return nil
+	}
+	importPath, version := mod.ImportPath, mod.Version
+	if mod.SourceVersion != "" {
+		importPath, version = mod.SourcePath, mod.SourceVersion
+	}
+	zipPath := modZipPath(importPath, version)
+	if _, err := os.Stat(zipPath); err != nil {
+		return nil
+	}
+	return &modZip{Path: zipPath, Prefix: importPath + "@" + version + "/"}
+}
+
+func (z *modZip) open() error {
+	z.once.Do(func() {
+		var info os.FileInfo
+		if info, z.err = os.Stat(z.Path); z.err != nil {
+			return
+		}
+		z.file = &reopenFile{path: z.Path}
+		var reader *zip.Reader
+		if reader, z.err = zip.NewReader(z.file, info.Size()); z.err != nil {
+			return
+		}
+		z.files = map[string]*zip.File{}
+		for _, f := range reader.File {
+			if !strings.HasPrefix(f.Name, z.Prefix) || strings.HasSuffix(f.Name, "/") {
+				continue
+			}
+			z.files[f.Name[len(z.Prefix):]] = f
+		}
+	})
+	return z.err
+}
+
+func (z *modZip) Close() error {
+	if z.file == nil {
+		return nil
+	}
+	return z.file.Close()
+}
+
+// Open opens a file by its module relative, slash separated path.
+func (z *modZip) Open(relPath string) (io.ReadCloser, os.FileInfo, error) {
+	if err := z.open(); err != nil {
+		return nil, nil, err
+	}
+	f, ok := z.files[relPath]
+	if !ok {
+		return nil, nil, &os.PathError{Op: "open", Path: z.Path + "#" + relPath, Err: os.ErrNotExist}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, f.FileInfo(), nil
+}
+
+func (z *modZip) Stat(relPath string) (os.FileInfo, error) {
+	if err := z.open(); err != nil {
+		return nil, err
+	}
+	f, ok := z.files[relPath]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: z.Path + "#" + relPath, Err: os.ErrNotExist}
+	}
+	return f.FileInfo(), nil
+}
+
+// globModZipFiles returns the files in the module zip matching any of the
+// copy patterns, as paths within the (absent) module dir, with the same
+// exclusions and limits as vendorplan.Glob.
+func globModZipFiles(mod *Mod, copyPat []string, maxMatches int, pkgs vendorplan.PkgFilter) (map[string]bool, error) {
+	if err := mod.Zip.open(); err != nil {
+		return nil, err
+	}
+	patterns, err := vendorplan.CompilePatterns(mod.Dir, copyPat)
+	if err != nil {
+		return nil, err
+	}
+
+	// Module zips don't contain nested modules, but check regardless
+	nested := []string{}
+	for relPath := range mod.Zip.files {
+		if path.Base(relPath) == "go.mod" && relPath != "go.mod" {
+			nested = append(nested, path.Dir(relPath)+"/")
+		}
+	}
+
+	matches := map[string]bool{}
+	counts := make([]int, len(patterns))
+
+files:
+	for relPath := range mod.Zip.files {
+		if !pkgs.Keep(nfc(relPath)) {
+			continue
+		}
+		for _, seg := range strings.Split(path.Dir(relPath), "/") {
+			if vendorplan.SkipDirs[seg] {
+				continue files
+			}
+		}
+		for _, dir := range nested {
+			if strings.HasPrefix(relPath, dir) {
+				continue files
+			}
+		}
+
+		name := filepath.Join(mod.Dir, filepath.FromSlash(nfc(relPath)))
+		for i, p := range patterns {
+			if p.Match(name) {
+				matches[filepath.Join(mod.Dir, filepath.FromSlash(relPath))] = false
+				counts[i]++
+				if maxMatches > 0 && counts[i] > maxMatches {
+					return nil, &vendorplan.TooManyMatchesError{Pattern: p.String(), Limit: maxMatches}
+				}
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+// copyModZipFile extracts a file of the module zip to dst.
+func copyModZipFile(mod *Mod, vendorFile, dst string) (int64, error) {
+	relPath, ok := modRelPath(mod, vendorFile)
+	if !ok {
+		return 0, fmt.Errorf("%s is outside of module dir", vendorFile)
+	}
+	src, info, err := mod.Zip.Open(relPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	return vendorplan.WriteFile(longPath(dst), src, info.Mode(), fileMode)
+}